@@ -0,0 +1,119 @@
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EndpointSelector selects Cilium endpoints, which are pods, by label
+type EndpointSelector struct {
+	MatchLabels      map[string]string                 `json:"matchLabels,omitempty"`
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// Entity is a well-known set of endpoints, such as "world" or "cluster"
+type Entity string
+
+const (
+	// EntityWorld is everything outside the cluster
+	EntityWorld Entity = "world"
+
+	// EntityCluster is every endpoint in the cluster
+	EntityCluster Entity = "cluster"
+
+	// EntityKubeAPIServer is the Kubernetes API server
+	EntityKubeAPIServer Entity = "kube-apiserver"
+)
+
+// L4Proto is a layer 4 protocol
+type L4Proto string
+
+const (
+	// ProtoTCP is TCP
+	ProtoTCP L4Proto = "TCP"
+
+	// ProtoUDP is UDP
+	ProtoUDP L4Proto = "UDP"
+
+	// ProtoAny matches any protocol
+	ProtoAny L4Proto = "ANY"
+)
+
+// PortProtocol is a port and the protocol it is reached over
+type PortProtocol struct {
+	Port     string  `json:"port"`
+	Protocol L4Proto `json:"protocol,omitempty"`
+}
+
+// FQDNSelector matches a DNS name exactly or by wildcard pattern
+type FQDNSelector struct {
+	MatchName    string `json:"matchName,omitempty"`
+	MatchPattern string `json:"matchPattern,omitempty"`
+}
+
+// PortRuleDNS restricts which names may be looked up through a port
+type PortRuleDNS FQDNSelector
+
+// L7Rules are application-level rules applied to traffic on a port
+type L7Rules struct {
+	DNS []PortRuleDNS `json:"dns,omitempty"`
+}
+
+// PortRule allows traffic to a set of ports, optionally subject to L7 rules
+type PortRule struct {
+	Ports []PortProtocol `json:"ports,omitempty"`
+	Rules *L7Rules       `json:"rules,omitempty"`
+}
+
+// CIDRRule allows traffic to a CIDR, minus any excepted ranges
+type CIDRRule struct {
+	Cidr        string   `json:"cidr"`
+	ExceptCIDRs []string `json:"except,omitempty"`
+}
+
+// IngressRule allows traffic into the selected endpoints. An empty rule
+// allows nothing but still puts the endpoints into default deny.
+type IngressRule struct {
+	FromEndpoints []EndpointSelector `json:"fromEndpoints,omitempty"`
+	FromEntities  []Entity           `json:"fromEntities,omitempty"`
+	FromCIDRSet   []CIDRRule         `json:"fromCIDRSet,omitempty"`
+	ToPorts       []PortRule         `json:"toPorts,omitempty"`
+}
+
+// EgressRule allows traffic out of the selected endpoints
+type EgressRule struct {
+	ToEndpoints []EndpointSelector `json:"toEndpoints,omitempty"`
+	ToEntities  []Entity           `json:"toEntities,omitempty"`
+	ToCIDRSet   []CIDRRule         `json:"toCIDRSet,omitempty"`
+	ToFQDNs     []FQDNSelector     `json:"toFQDNs,omitempty"`
+	ToPorts     []PortRule         `json:"toPorts,omitempty"`
+}
+
+// Rule is the spec of a CiliumNetworkPolicy
+type Rule struct {
+	EndpointSelector EndpointSelector `json:"endpointSelector"`
+	Ingress          []IngressRule    `json:"ingress,omitempty"`
+	Egress           []EgressRule     `json:"egress,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CiliumNetworkPolicy is a namespaced Cilium network policy
+type CiliumNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Rule `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CiliumNetworkPolicyList contains a list of CiliumNetworkPolicy
+type CiliumNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CiliumNetworkPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CiliumNetworkPolicy{}, &CiliumNetworkPolicyList{})
+}
@@ -0,0 +1,22 @@
+// Package v2 contains the subset of the Cilium cilium.io/v2 API used by the
+// operator. The CRDs are installed by Cilium, not by this operator.
+// +kubebuilder:object:generate=true
+// +kubebuilder:skip
+// +groupName=cilium.io
+package v2
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is group version used to register these objects
+	GroupVersion = schema.GroupVersion{Group: "cilium.io", Version: "v2"}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
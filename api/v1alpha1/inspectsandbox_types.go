@@ -9,6 +9,11 @@ import (
 
 // InspectSandboxSpec defines the desired state of an InspectSandbox
 type InspectSandboxSpec struct {
+	// TemplateRef builds the sandbox from an InspectSandboxTemplate. The
+	// rest of the spec then overrides the template rather than replacing it.
+	// +optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+
 	// Services is a map of service configurations to run in the sandbox
 	// +optional
 	Services map[string]ServiceSpec `json:"services,omitempty"`
@@ -24,8 +29,171 @@ type InspectSandboxSpec struct {
 	// Volumes defines persistent volumes for the sandbox
 	// +optional
 	Volumes map[string]VolumeSpec `json:"volumes,omitempty"`
+
+	// FailureGracePeriodSeconds is how long a service may report a pod
+	// failure such as ImagePullBackOff before the sandbox is marked Failed.
+	// Defaults to the operator's --failure-grace-period.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FailureGracePeriodSeconds *int32 `json:"failureGracePeriodSeconds,omitempty"`
+
+	// VolumeRetentionPolicy controls whether volume claims are deleted or
+	// kept when the sandbox is deleted. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	VolumeRetentionPolicy VolumeRetentionPolicy `json:"volumeRetentionPolicy,omitempty"`
+
+	// TTLSecondsAfterCreation deletes the sandbox this many seconds after
+	// it was created, whatever state it is in
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterCreation *int32 `json:"ttlSecondsAfterCreation,omitempty"`
+
+	// TTLSecondsAfterReady deletes the sandbox this many seconds after it
+	// first became ready
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterReady *int32 `json:"ttlSecondsAfterReady,omitempty"`
+
+	// ActiveDeadlineSeconds is how long after creation the sandbox's
+	// services may run. Once it passes they are scaled to zero and the
+	// sandbox is marked Failed, but it is kept until a TTL or the user
+	// deletes it.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// Suspend scales every service to zero while keeping volumes, Services
+	// and network policies, so the sandbox can be resumed where it left off
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Heartbeat deletes the sandbox when its creator stops renewing a
+	// heartbeat, so sandboxes left behind by crashed clients are cleaned up
+	// +optional
+	Heartbeat *HeartbeatSpec `json:"heartbeat,omitempty"`
 }
 
+// TemplateReference names the InspectSandboxTemplate a sandbox is built from
+type TemplateReference struct {
+	// Name of an InspectSandboxTemplate in the sandbox's namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// UpdatePolicy controls whether changes to the template reach sandboxes
+	// already built from it. Defaults to OnCreate, which keeps the template
+	// as it was when the sandbox was first reconciled.
+	// +kubebuilder:validation:Enum=OnCreate;Rollout
+	// +optional
+	UpdatePolicy TemplateUpdatePolicy `json:"updatePolicy,omitempty"`
+}
+
+// TemplateUpdatePolicy describes how template changes reach sandboxes
+type TemplateUpdatePolicy string
+
+const (
+	// TemplateUpdateOnCreate keeps the template a sandbox was created from
+	TemplateUpdateOnCreate TemplateUpdatePolicy = "OnCreate"
+
+	// TemplateUpdateRollout rebuilds the sandbox whenever its template changes
+	TemplateUpdateRollout TemplateUpdatePolicy = "Rollout"
+)
+
+// HeartbeatAnnotation is set on a sandbox by its creator to the RFC 3339
+// time of its latest heartbeat, unless the heartbeat uses a Lease
+const HeartbeatAnnotation = "inspect.example.com/heartbeat"
+
+// HeartbeatSpec configures how a sandbox's creator shows it is still alive
+type HeartbeatSpec struct {
+	// TimeoutSeconds is how long after the last heartbeat the sandbox is
+	// deleted. Until the first heartbeat, it counts from creation.
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds int32 `json:"timeoutSeconds"`
+
+	// LeaseName is a coordination.k8s.io Lease in the sandbox's namespace
+	// whose renewTime is the heartbeat. When unset, the
+	// inspect.example.com/heartbeat annotation is used instead.
+	// +optional
+	LeaseName string `json:"leaseName,omitempty"`
+}
+
+// VolumeRetentionPolicy describes what happens to volume claims on deletion
+type VolumeRetentionPolicy string
+
+const (
+	// VolumeRetentionDelete deletes volume claims along with the sandbox
+	VolumeRetentionDelete VolumeRetentionPolicy = "Delete"
+
+	// VolumeRetentionRetain orphans volume claims so they outlive the sandbox
+	VolumeRetentionRetain VolumeRetentionPolicy = "Retain"
+)
+
+// SandboxPhase summarises where a sandbox is in its lifecycle
+type SandboxPhase string
+
+const (
+	// PhasePending means no service pods have been created yet
+	PhasePending SandboxPhase = "Pending"
+
+	// PhaseProvisioning means services are starting but not all are ready
+	PhaseProvisioning SandboxPhase = "Provisioning"
+
+	// PhaseReady means every service is ready and policies are in place
+	PhaseReady SandboxPhase = "Ready"
+
+	// PhaseDegraded means the sandbox was ready but no longer is
+	PhaseDegraded SandboxPhase = "Degraded"
+
+	// PhaseTerminating means the sandbox is being torn down
+	PhaseTerminating SandboxPhase = "Terminating"
+
+	// PhaseFailed means the sandbox can't become ready without intervention
+	PhaseFailed SandboxPhase = "Failed"
+
+	// PhaseSuspended means the sandbox's services are scaled to zero on request
+	PhaseSuspended SandboxPhase = "Suspended"
+)
+
+const (
+	// ConditionReady is true when every service is ready and network
+	// policies are in place
+	ConditionReady = "Ready"
+
+	// ConditionNetworkPolicyReady is true when the sandbox's network
+	// policies have been applied
+	ConditionNetworkPolicyReady = "NetworkPolicyReady"
+
+	// ConditionVolumesReady is true when every volume claim is bound
+	ConditionVolumesReady = "VolumesReady"
+
+	// ConditionFailed is true when a service has been failing for longer
+	// than the failure grace period
+	ConditionFailed = "Failed"
+
+	// ConditionTerminating is set while the sandbox is being torn down
+	ConditionTerminating = "Terminating"
+
+	// ConditionDeadlineExceeded is true once the sandbox has run past its
+	// active deadline and its services have been stopped
+	ConditionDeadlineExceeded = "DeadlineExceeded"
+
+	// ConditionExpired is set when the sandbox is deleted for outliving a
+	// TTL or its heartbeat timeout
+	ConditionExpired = "Expired"
+
+	// ConditionSuspended is true while the sandbox is suspended. Its last
+	// transition time is when the sandbox was last suspended or resumed.
+	ConditionSuspended = "Suspended"
+
+	// ConditionDomainAllowList is true when egress to allowDomains is
+	// permitted, which needs Cilium. It is only set when domains are listed.
+	ConditionDomainAllowList = "DomainAllowListEnforced"
+
+	// ConditionTemplateResolved is true when the sandbox's templateRef has
+	// been merged into a valid spec. It is only set when a template is used.
+	ConditionTemplateResolved = "TemplateResolved"
+)
+
 // +k8s:deepcopy-gen=true
 
 // ServiceSpec defines a service to be run in the sandbox
@@ -49,11 +217,13 @@ type ServiceSpec struct {
 	// +optional
 	WorkingDir string `json:"workingDir,omitempty"`
 
-	// DNSRecord indicates whether to create a DNS record for this service
+	// DNSRecord indicates whether the service's name resolves to it from
+	// every pod in the sandbox, as under docker compose. Defaults to true.
 	// +optional
-	DNSRecord bool `json:"dnsRecord,omitempty"`
+	DNSRecord *bool `json:"dnsRecord,omitempty"`
 
-	// AdditionalDNSRecords provides additional domain names for this service
+	// AdditionalDNSRecords provides additional domain names that resolve to
+	// this service from every pod in the sandbox
 	// +optional
 	AdditionalDNSRecords []string `json:"additionalDnsRecords,omitempty"`
 
@@ -61,7 +231,8 @@ type ServiceSpec struct {
 	// +optional
 	Env []corev1.EnvVar `json:"env,omitempty"`
 
-	// Volumes to mount
+	// Volumes to mount, using compose-style "name:/path[:ro]" syntax where
+	// name refers to an entry in the sandbox Volumes
 	// +optional
 	Volumes []string `json:"volumes,omitempty"`
 
@@ -72,6 +243,152 @@ type ServiceSpec struct {
 	// Networks this service belongs to
 	// +optional
 	Networks []string `json:"networks,omitempty"`
+
+	// Ports the service's container listens on, exposed on its Service
+	// +optional
+	Ports []ServicePort `json:"ports,omitempty"`
+
+	// Healthcheck tells when the service is ready for use, as under
+	// compose. Without one the service is ready as soon as its container
+	// starts.
+	// +optional
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty"`
+
+	// DependsOn lists services that must be up before this service's
+	// StatefulSet is created, as under compose's depends_on. It only orders
+	// creation, so a service keeps running if a dependency later fails.
+	// +optional
+	DependsOn []ServiceDependency `json:"dependsOn,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// ServiceDependency names a service to wait for
+type ServiceDependency struct {
+	// Service is the name of the service to wait for
+	// +kubebuilder:validation:MinLength=1
+	Service string `json:"service"`
+
+	// Condition is what to wait for. Started waits for the service's
+	// container to be running and Healthy for its healthcheck to pass.
+	// Defaults to Started.
+	// +kubebuilder:validation:Enum=Started;Healthy
+	// +optional
+	Condition DependencyCondition `json:"condition,omitempty"`
+}
+
+// DependencyCondition is what a service waits for from a dependency
+type DependencyCondition string
+
+const (
+	// DependencyStarted waits for the dependency's container to be running
+	DependencyStarted DependencyCondition = "Started"
+
+	// DependencyHealthy waits for the dependency to be ready, which means
+	// its healthcheck passes
+	DependencyHealthy DependencyCondition = "Healthy"
+)
+
+// ServiceReasonWaitingForDependency is the service status reason while its
+// StatefulSet is held back until the services it depends on are up
+const ServiceReasonWaitingForDependency = "WaitingForDependency"
+
+// +k8s:deepcopy-gen=true
+
+// ServicePort defines a port exposed by a service
+type ServicePort struct {
+	// Name of the port, used for SRV records. Defaults to <protocol>-<port>.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// ContainerPort is the port the container listens on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	ContainerPort int32 `json:"containerPort"`
+
+	// Protocol for the port, defaults to TCP
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// Healthcheck defines how to check that a service is healthy. Exactly one
+// of exec, httpGet and tcpSocket must be set.
+type Healthcheck struct {
+	// Exec is a command run in the container, which passes if it exits 0.
+	// It isn't run through a shell, so use ["sh", "-c", "..."] for one.
+	// +optional
+	Exec []string `json:"exec,omitempty"`
+
+	// HTTPGet passes if a request to the container gets a 2xx or 3xx
+	// response
+	// +optional
+	HTTPGet *HTTPGetHealthcheck `json:"httpGet,omitempty"`
+
+	// TCPSocket passes if the container accepts connections on a port
+	// +optional
+	TCPSocket *TCPSocketHealthcheck `json:"tcpSocket,omitempty"`
+
+	// IntervalSeconds between checks. Defaults to 30, as in compose.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	IntervalSeconds *int32 `json:"intervalSeconds,omitempty"`
+
+	// TimeoutSeconds after which a check fails. Defaults to 30, as in
+	// compose.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// Retries is how many checks in a row must fail before the service is
+	// unhealthy. Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retries *int32 `json:"retries,omitempty"`
+
+	// StartPeriodSeconds gives the service time to start, during which
+	// failed checks don't count. The service is ready as soon as a check
+	// passes.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartPeriodSeconds *int32 `json:"startPeriodSeconds,omitempty"`
+
+	// Liveness restarts the container once it is unhealthy, rather than
+	// only marking it not ready. Compose never restarts unhealthy
+	// containers, so this is off by default.
+	// +optional
+	Liveness bool `json:"liveness,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// HTTPGetHealthcheck checks an HTTP endpoint in the container
+type HTTPGetHealthcheck struct {
+	// Path to request. Defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Port to connect to
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+
+	// Scheme to connect with, defaults to HTTP
+	// +kubebuilder:validation:Enum=HTTP;HTTPS
+	// +optional
+	Scheme corev1.URIScheme `json:"scheme,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// TCPSocketHealthcheck checks that the container accepts connections
+type TCPSocketHealthcheck struct {
+	// Port to connect to
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
 }
 
 // +k8s:deepcopy-gen=true
@@ -84,12 +401,25 @@ type VolumeSpec struct {
 	// StorageClass to use
 	// +optional
 	StorageClass string `json:"storageClass,omitempty"`
+
+	// AccessModes for the claim, defaults to ReadWriteOnce. Volumes shared
+	// between services scheduled on different nodes need ReadWriteMany.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
 }
 
 // +k8s:deepcopy-gen=true
 
 // InspectSandboxStatus defines the observed state of InspectSandbox
 type InspectSandboxStatus struct {
+	// Phase summarises the state of the sandbox
+	// +optional
+	Phase SandboxPhase `json:"phase,omitempty"`
+
+	// ObservedGeneration is the generation of the spec this status reflects
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// Conditions represent the latest available observations of the sandbox state
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
@@ -97,6 +427,41 @@ type InspectSandboxStatus struct {
 	// Services represents the status of individual services
 	// +optional
 	Services map[string]ServiceStatus `json:"services,omitempty"`
+
+	// LastHeartbeatTime is the latest heartbeat seen from the sandbox's creator
+	// +optional
+	LastHeartbeatTime *metav1.Time `json:"lastHeartbeatTime,omitempty"`
+
+	// FirstReadyTime is when every service was first ready at once
+	// +optional
+	FirstReadyTime *metav1.Time `json:"firstReadyTime,omitempty"`
+
+	// DriftCorrected counts the child objects the operator has had to
+	// restore after they were deleted or modified by something else
+	// +optional
+	DriftCorrected int64 `json:"driftCorrected,omitempty"`
+
+	// Template is the copy of the referenced template the sandbox is built
+	// from, kept so later changes only apply when they are rolled out
+	// +optional
+	Template *TemplateSnapshot `json:"template,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// TemplateSnapshot records the template a sandbox was last built from
+type TemplateSnapshot struct {
+	// Name of the InspectSandboxTemplate
+	Name string `json:"name"`
+
+	// Generation of the template that was copied
+	Generation int64 `json:"generation"`
+
+	// Spec is the template's spec at that generation
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec InspectSandboxSpec `json:"spec"`
 }
 
 // +k8s:deepcopy-gen=true
@@ -106,14 +471,57 @@ type ServiceStatus struct {
 	// Ready indicates whether the service is ready
 	Ready bool `json:"ready"`
 
+	// Started indicates whether the service's container is running, even
+	// if it isn't ready yet
+	// +optional
+	Started bool `json:"started,omitempty"`
+
 	// Message provides additional status information
 	// +optional
 	Message string `json:"message,omitempty"`
+
+	// DNSNames lists the names that resolve to this service from other pods
+	// in the sandbox
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// PodName is the name of the pod running the service
+	// +optional
+	PodName string `json:"podName,omitempty"`
+
+	// PodIP is the IP address of the pod running the service
+	// +optional
+	PodIP string `json:"podIP,omitempty"`
+
+	// RestartCount is the number of times the service container restarted
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// ImageID is the resolved image digest the service container runs
+	// +optional
+	ImageID string `json:"imageID,omitempty"`
+
+	// LastTerminationReason is why the service container last exited
+	// +optional
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+
+	// Reason is a machine-readable cause for the service not running, such
+	// as ImagePullBackOff, CrashLoopBackOff, Unschedulable or
+	// WaitingForDependency
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// FailingSince is when the current failure Reason was first observed
+	// +optional
+	FailingSince *metav1.Time `json:"failingSince,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,shortName=isbox
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // InspectSandbox is the Schema for the inspectsandboxes API
 type InspectSandbox struct {
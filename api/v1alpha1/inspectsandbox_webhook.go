@@ -0,0 +1,410 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// MaxQualifiedServiceNameLength is the longest "<sandbox>-<service>" name
+	// allowed. StatefulSet pods get a controller-revision-hash label of
+	// "<name>-<hash>", which has to fit in a 63 character label value.
+	MaxQualifiedServiceNameLength = 52
+
+	// ReservedContainerName is the name of the DNS resolver sidecar, which
+	// services can't use
+	ReservedContainerName = "dns-resolver"
+)
+
+// InspectSandboxDefaulter fills in defaults for InspectSandbox services
+type InspectSandboxDefaulter struct {
+	// RuntimeClassName is used for services that don't set one
+	RuntimeClassName string
+
+	// Resources are used for services that don't request any
+	Resources corev1.ResourceRequirements
+}
+
+// InspectSandboxValidator rejects InspectSandbox specs that can't be reconciled
+type InspectSandboxValidator struct{}
+
+// +kubebuilder:webhook:path=/mutate-inspect-example-com-v1alpha1-inspectsandbox,mutating=true,failurePolicy=fail,sideEffects=None,groups=inspect.example.com,resources=inspectsandboxes,verbs=create;update,versions=v1alpha1,name=minspectsandbox.inspect.example.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-inspect-example-com-v1alpha1-inspectsandbox,mutating=false,failurePolicy=fail,sideEffects=None,groups=inspect.example.com,resources=inspectsandboxes,verbs=create;update,versions=v1alpha1,name=vinspectsandbox.inspect.example.com,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the InspectSandbox webhooks with the manager
+func SetupWebhookWithManager(mgr ctrl.Manager, defaulter *InspectSandboxDefaulter) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&InspectSandbox{}).
+		WithDefaulter(defaulter).
+		WithValidator(&InspectSandboxValidator{}).
+		Complete()
+}
+
+// Default implements admission.CustomDefaulter
+func (d *InspectSandboxDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	sandbox, ok := obj.(*InspectSandbox)
+	if !ok {
+		return fmt.Errorf("expected an InspectSandbox but got %T", obj)
+	}
+
+	// Defaults would override the template, so the controller applies them
+	// once the template is merged in
+	if sandbox.Spec.TemplateRef != nil {
+		return nil
+	}
+
+	d.DefaultSpec(&sandbox.Spec)
+	return nil
+}
+
+// DefaultSpec fills in defaults for every service in spec
+func (d *InspectSandboxDefaulter) DefaultSpec(spec *InspectSandboxSpec) {
+	for svcName, svcSpec := range spec.Services {
+		if svcSpec.RuntimeClassName == "" {
+			svcSpec.RuntimeClassName = d.RuntimeClassName
+		}
+
+		// Only fill in resources when none were given, since mixing in
+		// defaults could leave requests above the service's own limits
+		if len(svcSpec.Resources.Requests) == 0 && len(svcSpec.Resources.Limits) == 0 {
+			svcSpec.Resources = *d.Resources.DeepCopy()
+		}
+
+		// Services are reachable by name unless they opt out, as under compose
+		if svcSpec.DNSRecord == nil {
+			dnsRecord := true
+			svcSpec.DNSRecord = &dnsRecord
+		}
+
+		spec.Services[svcName] = svcSpec
+	}
+}
+
+// SetDefaultResource sets both the default request and limit for name to
+// value, leaving the defaults untouched if value is empty
+func (d *InspectSandboxDefaulter) SetDefaultResource(name corev1.ResourceName, value string) error {
+	if value == "" {
+		return nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return err
+	}
+	if d.Resources.Requests == nil {
+		d.Resources.Requests = corev1.ResourceList{}
+	}
+	if d.Resources.Limits == nil {
+		d.Resources.Limits = corev1.ResourceList{}
+	}
+	d.Resources.Requests[name] = quantity
+	d.Resources.Limits[name] = quantity
+	return nil
+}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *InspectSandboxValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validateInspectSandbox(obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *InspectSandboxValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, validateInspectSandbox(newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *InspectSandboxValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateInspectSandbox returns an Invalid error describing everything
+// wrong with the sandbox, or nil if it is valid
+func validateInspectSandbox(obj runtime.Object) error {
+	sandbox, ok := obj.(*InspectSandbox)
+	if !ok {
+		return fmt.Errorf("expected an InspectSandbox but got %T", obj)
+	}
+
+	errs := ValidateInspectSandboxSpec(sandbox.Name, &sandbox.Spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("InspectSandbox").GroupKind(), sandbox.Name, errs)
+}
+
+// ValidateInspectSandboxSpec checks that the spec of a sandbox called name
+// only references declared networks, volumes and services, that services
+// don't depend on each other in a cycle, that name can label child objects,
+// and that every name it produces is valid once prefixed with it. A spec with a templateRef only
+// overrides its template, so images and references to anything the
+// template may declare are checked once merged.
+func ValidateInspectSandboxSpec(name string, spec *InspectSandboxSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	partial := spec.TemplateRef != nil
+
+	// Child objects are labelled with the sandbox name
+	for _, msg := range validation.IsValidLabelValue(name) {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), name, msg))
+	}
+
+	// Validate in a stable order so errors are reported consistently
+	svcNames := make([]string, 0, len(spec.Services))
+	for svcName := range spec.Services {
+		svcNames = append(svcNames, svcName)
+	}
+	sort.Strings(svcNames)
+
+	dnsNames := make(map[string]string)
+	for _, svcName := range svcNames {
+		svcSpec := spec.Services[svcName]
+		svcPath := fldPath.Child("services").Key(svcName)
+
+		svcNameErrs := validation.IsDNS1123Label(svcName)
+		for _, msg := range svcNameErrs {
+			errs = append(errs, field.Invalid(svcPath, svcName, msg))
+		}
+		// The qualified name is also the headless Service's, so must be a
+		// DNS-1035 label, which a sandbox name with dots or a leading digit
+		// isn't
+		qualified := fmt.Sprintf("%s-%s", name, svcName)
+		switch {
+		case len(qualified) > MaxQualifiedServiceNameLength:
+			errs = append(errs, field.Invalid(svcPath, svcName, fmt.Sprintf(
+				"%q is %d characters long, sandbox and service names together must be at most %d",
+				qualified, len(qualified), MaxQualifiedServiceNameLength)))
+		case len(svcNameErrs) == 0:
+			for _, msg := range validation.IsDNS1035Label(qualified) {
+				errs = append(errs, field.Invalid(svcPath, svcName, fmt.Sprintf("%q: %s", qualified, msg)))
+			}
+		}
+		if svcName == ReservedContainerName {
+			errs = append(errs, field.Invalid(svcPath, svcName, "name is reserved for the DNS resolver sidecar"))
+		}
+
+		if svcSpec.Image == "" && !partial {
+			errs = append(errs, field.Required(svcPath.Child("image"), "image is required"))
+		}
+
+		for i, network := range svcSpec.Networks {
+			if _, ok := spec.Networks[network]; !ok && !partial {
+				errs = append(errs, field.NotFound(svcPath.Child("networks").Index(i), network))
+			}
+		}
+
+		for i, entry := range svcSpec.Volumes {
+			volPath := svcPath.Child("volumes").Index(i)
+			mount, err := ParseVolumeMount(entry)
+			if err != nil {
+				errs = append(errs, field.Invalid(volPath, entry, err.Error()))
+				continue
+			}
+			if _, ok := spec.Volumes[mount.Name]; !ok && !partial {
+				errs = append(errs, field.NotFound(volPath, mount.Name))
+			}
+		}
+
+		if svcSpec.Healthcheck != nil {
+			errs = append(errs, validateHealthcheck(svcSpec.Healthcheck, svcPath.Child("healthcheck"))...)
+		}
+
+		dependencies := make(map[string]bool)
+		for i, dep := range svcSpec.DependsOn {
+			depPath := svcPath.Child("dependsOn").Index(i)
+			if dependencies[dep.Service] {
+				errs = append(errs, field.Duplicate(depPath.Child("service"), dep.Service))
+			}
+			dependencies[dep.Service] = true
+
+			depSpec, ok := spec.Services[dep.Service]
+			switch {
+			case !ok && !partial:
+				errs = append(errs, field.NotFound(depPath.Child("service"), dep.Service))
+			case ok && dep.Condition == DependencyHealthy && depSpec.Healthcheck == nil && !partial:
+				errs = append(errs, field.Invalid(depPath.Child("condition"), dep.Condition,
+					fmt.Sprintf("service %s has no healthcheck", dep.Service)))
+			}
+		}
+
+		// A template may still set dnsRecord, so partial specs only count it
+		// when given
+		names := svcSpec.AdditionalDNSRecords
+		if (svcSpec.DNSRecord == nil && !partial) || (svcSpec.DNSRecord != nil && *svcSpec.DNSRecord) {
+			names = append([]string{svcName}, names...)
+		}
+		for _, dnsName := range names {
+			dnsName = strings.TrimSuffix(dnsName, ".")
+			recordPath := svcPath.Child("additionalDnsRecords")
+			for _, msg := range validation.IsDNS1123Subdomain(dnsName) {
+				errs = append(errs, field.Invalid(recordPath, dnsName, msg))
+			}
+			if other, ok := dnsNames[dnsName]; ok && other != svcName {
+				errs = append(errs, field.Duplicate(recordPath, dnsName))
+			}
+			dnsNames[dnsName] = svcName
+		}
+	}
+
+	if _, err := ServiceStartOrder(spec.Services); err != nil {
+		errs = append(errs, field.Forbidden(fldPath.Child("services"), err.Error()))
+	}
+
+	for i, domain := range spec.AllowDomains {
+		domainPath := fldPath.Child("allowDomains").Index(i)
+		if strings.HasPrefix(domain, "*.") {
+			errs = append(errs, field.Invalid(domainPath, domain, "subdomains are allowed automatically, list the domain without a wildcard"))
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(domain) {
+			errs = append(errs, field.Invalid(domainPath, domain, msg))
+		}
+	}
+
+	for network := range spec.Networks {
+		// Networks become part of the label key inspect.example.com/network-<name>
+		for _, msg := range validation.IsQualifiedName("inspect.example.com/network-" + network) {
+			errs = append(errs, field.Invalid(fldPath.Child("networks").Key(network), network, msg))
+		}
+	}
+
+	for volName, volSpec := range spec.Volumes {
+		volPath := fldPath.Child("volumes").Key(volName)
+		for _, msg := range validation.IsDNS1123Label(volName) {
+			errs = append(errs, field.Invalid(volPath, volName, msg))
+		}
+		if volSpec.Size == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(volSpec.Size)
+		if err != nil {
+			errs = append(errs, field.Invalid(volPath.Child("size"), volSpec.Size, err.Error()))
+			continue
+		}
+		if quantity.Sign() <= 0 {
+			errs = append(errs, field.Invalid(volPath.Child("size"), volSpec.Size, "must be greater than zero"))
+		}
+	}
+
+	return errs
+}
+
+// ServiceStartOrder returns the names of services ordered so that each
+// comes after the services it depends on, otherwise alphabetically.
+// Dependencies on services that aren't in the map are ignored. It returns
+// an error naming the cycle if services depend on each other.
+func ServiceStartOrder(services map[string]ServiceSpec) ([]string, error) {
+	names := make([]string, 0, len(services))
+	for svcName := range services {
+		names = append(names, svcName)
+	}
+	sort.Strings(names)
+
+	// Depth-first, keeping the path so far to report cycles
+	done := make(map[string]bool, len(services))
+	var path []string
+	order := make([]string, 0, len(services))
+	var visit func(svcName string) error
+	visit = func(svcName string) error {
+		if done[svcName] {
+			return nil
+		}
+		for i, visiting := range path {
+			if visiting == svcName {
+				cycle := append(append([]string{}, path[i:]...), svcName)
+				return fmt.Errorf("dependsOn forms a cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		path = append(path, svcName)
+		for _, dep := range services[svcName].DependsOn {
+			if _, ok := services[dep.Service]; !ok {
+				continue
+			}
+			if err := visit(dep.Service); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+
+		done[svcName] = true
+		order = append(order, svcName)
+		return nil
+	}
+
+	for _, svcName := range names {
+		if err := visit(svcName); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// validateHealthcheck checks that a healthcheck sets exactly one check
+func validateHealthcheck(hc *Healthcheck, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	var checks []string
+	if hc.Exec != nil {
+		checks = append(checks, "exec")
+		if len(hc.Exec) == 0 {
+			errs = append(errs, field.Required(fldPath.Child("exec"), "command must not be empty"))
+		}
+	}
+	if hc.HTTPGet != nil {
+		checks = append(checks, "httpGet")
+	}
+	if hc.TCPSocket != nil {
+		checks = append(checks, "tcpSocket")
+	}
+
+	switch len(checks) {
+	case 0:
+		errs = append(errs, field.Required(fldPath, "one of exec, httpGet or tcpSocket is required"))
+	case 1:
+	default:
+		errs = append(errs, field.Invalid(fldPath, strings.Join(checks, ", "),
+			"only one of exec, httpGet or tcpSocket may be set"))
+	}
+	return errs
+}
+
+// ParseVolumeMount parses a compose-style "name:/path[:ro]" volume entry
+func ParseVolumeMount(entry string) (corev1.VolumeMount, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return corev1.VolumeMount{}, fmt.Errorf("volume %q must be of the form name:/path[:ro]", entry)
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      parts[0],
+		MountPath: parts[1],
+	}
+	if mount.Name == "" {
+		return corev1.VolumeMount{}, fmt.Errorf("volume %q is missing a volume name", entry)
+	}
+	if !path.IsAbs(mount.MountPath) {
+		return corev1.VolumeMount{}, fmt.Errorf("volume %q must be mounted at an absolute path", entry)
+	}
+
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			mount.ReadOnly = true
+		case "rw":
+		default:
+			return corev1.VolumeMount{}, fmt.Errorf("volume %q has unknown mode %q, expected ro or rw", entry, parts[2])
+		}
+	}
+
+	return mount, nil
+}
@@ -0,0 +1,419 @@
+package v1alpha1
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestInspectSandboxDefaulter(t *testing.T) {
+	defaulter := &InspectSandboxDefaulter{
+		RuntimeClassName: "gvisor",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+	}
+	optOut := false
+	sandbox := &InspectSandbox{Spec: InspectSandboxSpec{Services: map[string]ServiceSpec{
+		"default": {Image: "ubuntu"},
+		"db": {
+			Image:            "postgres",
+			RuntimeClassName: "kata",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			},
+			DNSRecord: &optOut,
+		},
+	}}}
+
+	if err := defaulter.Default(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defaulted := sandbox.Spec.Services["default"]
+	if defaulted.RuntimeClassName != "gvisor" {
+		t.Errorf("default runtimeClassName = %q, want gvisor", defaulted.RuntimeClassName)
+	}
+	if !reflect.DeepEqual(defaulted.Resources, defaulter.Resources) {
+		t.Errorf("default resources = %v, want %v", defaulted.Resources, defaulter.Resources)
+	}
+	if defaulted.DNSRecord == nil || !*defaulted.DNSRecord {
+		t.Errorf("default dnsRecord = %v, want true", defaulted.DNSRecord)
+	}
+
+	// Anything the service sets itself is left alone
+	db := sandbox.Spec.Services["db"]
+	if db.RuntimeClassName != "kata" {
+		t.Errorf("db runtimeClassName = %q, want kata", db.RuntimeClassName)
+	}
+	if len(db.Resources.Requests) != 0 || db.Resources.Limits.Cpu().String() != "500m" {
+		t.Errorf("db resources = %v, want only the 500m CPU limit", db.Resources)
+	}
+	if db.DNSRecord == nil || *db.DNSRecord {
+		t.Errorf("db dnsRecord = %v, want false", db.DNSRecord)
+	}
+}
+
+func TestValidateInspectSandboxSpec(t *testing.T) {
+	services := field.NewPath("spec", "services")
+	optOut := false
+
+	tests := []struct {
+		name    string
+		sandbox string
+		spec    InspectSandboxSpec
+		want    field.ErrorList
+	}{
+		{
+			name:    "valid",
+			sandbox: "task",
+			spec: InspectSandboxSpec{
+				Services: map[string]ServiceSpec{
+					"default": {Image: "ubuntu", Networks: []string{"internal"}, Volumes: []string{"data:/data:ro"}},
+					"web":     {Image: "nginx", AdditionalDNSRecords: []string{"example.com."}},
+				},
+				Networks:     map[string]string{"internal": ""},
+				Volumes:      map[string]VolumeSpec{"data": {Size: "1Gi"}},
+				AllowDomains: []string{"pypi.org"},
+			},
+		},
+		{
+			name:    "invalid and reserved service names",
+			sandbox: "task",
+			spec: InspectSandboxSpec{Services: map[string]ServiceSpec{
+				"Web":          {Image: "nginx", DNSRecord: &optOut},
+				"dns-resolver": {Image: "coredns"},
+			}},
+			want: field.ErrorList{
+				field.Invalid(services.Key("Web"), "Web",
+					"a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')"),
+				field.Invalid(services.Key("dns-resolver"), "dns-resolver", "name is reserved for the DNS resolver sidecar"),
+			},
+		},
+		{
+			name:    "qualified name too long",
+			sandbox: strings.Repeat("s", 45),
+			spec:    InspectSandboxSpec{Services: map[string]ServiceSpec{"database": {Image: "postgres"}}},
+			want: field.ErrorList{
+				field.Invalid(services.Key("database"), "database", `"`+strings.Repeat("s", 45)+
+					`-database" is 54 characters long, sandbox and service names together must be at most 52`),
+			},
+		},
+		{
+			name:    "sandbox name too long for a label",
+			sandbox: strings.Repeat("s", 64),
+			spec:    InspectSandboxSpec{},
+			want: field.ErrorList{
+				field.Invalid(field.NewPath("metadata", "name"), strings.Repeat("s", 64),
+					"must be no more than 63 characters"),
+			},
+		},
+		{
+			name:    "qualified names not DNS-1035 labels",
+			sandbox: "task.v2",
+			spec: InspectSandboxSpec{Services: map[string]ServiceSpec{
+				"web": {Image: "nginx"},
+			}},
+			want: field.ErrorList{
+				field.Invalid(services.Key("web"), "web", `"task.v2-web": a DNS-1035 label must consist of lower case alphanumeric characters or '-', start with an alphabetic character, and end with an alphanumeric character (e.g. 'my-name',  or 'abc-123', regex used for validation is '[a-z]([-a-z0-9]*[a-z0-9])?')`),
+			},
+		},
+		{
+			name:    "missing image, network and volume",
+			sandbox: "task",
+			spec: InspectSandboxSpec{Services: map[string]ServiceSpec{
+				"default": {Networks: []string{"internal"}, Volumes: []string{"data:/data", "data"}},
+			}},
+			want: field.ErrorList{
+				field.Required(services.Key("default").Child("image"), "image is required"),
+				field.NotFound(services.Key("default").Child("networks").Index(0), "internal"),
+				field.NotFound(services.Key("default").Child("volumes").Index(0), "data"),
+				field.Invalid(services.Key("default").Child("volumes").Index(1), "data",
+					`volume "data" must be of the form name:/path[:ro]`),
+			},
+		},
+		{
+			name:    "DNS record claimed twice",
+			sandbox: "task",
+			spec: InspectSandboxSpec{Services: map[string]ServiceSpec{
+				"a": {Image: "nginx", AdditionalDNSRecords: []string{"example.com"}},
+				"b": {Image: "nginx", AdditionalDNSRecords: []string{"example.com."}},
+			}},
+			want: field.ErrorList{
+				field.Duplicate(services.Key("b").Child("additionalDnsRecords"), "example.com"),
+			},
+		},
+		{
+			name:    "wildcard domain and bad volume size",
+			sandbox: "task",
+			spec: InspectSandboxSpec{
+				Services:     map[string]ServiceSpec{"default": {Image: "ubuntu"}},
+				Volumes:      map[string]VolumeSpec{"data": {Size: "0"}},
+				AllowDomains: []string{"*.example.com"},
+			},
+			want: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "allowDomains").Index(0), "*.example.com",
+					"subdomains are allowed automatically, list the domain without a wildcard"),
+				field.Invalid(field.NewPath("spec", "volumes").Key("data").Child("size"), "0", "must be greater than zero"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateInspectSandboxSpec(tt.sandbox, &tt.spec, field.NewPath("spec"))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors =\n%s\nwant\n%s", errorLines(got), errorLines(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseVolumeMount(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    corev1.VolumeMount
+		wantErr string
+	}{
+		{entry: "data:/data", want: corev1.VolumeMount{Name: "data", MountPath: "/data"}},
+		{entry: "data:/data:ro", want: corev1.VolumeMount{Name: "data", MountPath: "/data", ReadOnly: true}},
+		{entry: "data:/data:rw", want: corev1.VolumeMount{Name: "data", MountPath: "/data"}},
+		{entry: "data", wantErr: `volume "data" must be of the form name:/path[:ro]`},
+		{entry: ":/data", wantErr: `volume ":/data" is missing a volume name`},
+		{entry: "data:data", wantErr: `volume "data:data" must be mounted at an absolute path`},
+		{entry: "data:/data:rx", wantErr: `volume "data:/data:rx" has unknown mode "rx", expected ro or rw`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseVolumeMount(tt.entry)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("mount = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// dependsOn builds services that each depend on the named services
+func dependsOn(graph map[string][]string) map[string]ServiceSpec {
+	services := make(map[string]ServiceSpec, len(graph))
+	for svcName, deps := range graph {
+		svcSpec := ServiceSpec{Image: "ubuntu"}
+		for _, dep := range deps {
+			svcSpec.DependsOn = append(svcSpec.DependsOn, ServiceDependency{Service: dep})
+		}
+		services[svcName] = svcSpec
+	}
+	return services
+}
+
+func TestServiceStartOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		graph   map[string][]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "no dependencies",
+			graph: map[string][]string{"default": nil, "db": nil, "cache": nil},
+			want:  []string{"cache", "db", "default"},
+		},
+		{
+			name:  "dependencies first",
+			graph: map[string][]string{"a": {"db"}, "db": {"migrate"}, "migrate": nil, "cache": nil},
+			want:  []string{"migrate", "db", "a", "cache"},
+		},
+		{
+			name:  "shared dependency",
+			graph: map[string][]string{"web": {"db", "cache"}, "worker": {"db"}, "db": nil, "cache": nil},
+			want:  []string{"cache", "db", "web", "worker"},
+		},
+		{
+			name:  "unknown dependency is ignored",
+			graph: map[string][]string{"default": {"missing"}},
+			want:  []string{"default"},
+		},
+		{
+			name:    "self-dependency",
+			graph:   map[string][]string{"a": {"a"}},
+			wantErr: "dependsOn forms a cycle: a -> a",
+		},
+		{
+			name:    "two-node cycle",
+			graph:   map[string][]string{"a": {"b"}, "b": {"a"}},
+			wantErr: "dependsOn forms a cycle: a -> b -> a",
+		},
+		{
+			name:    "cycle behind a dependency",
+			graph:   map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}},
+			wantErr: "dependsOn forms a cycle: b -> c -> b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ServiceStartOrder(dependsOn(tt.graph))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceStartOrderDeterministic(t *testing.T) {
+	// Map iteration order varies between runs, so order many times over
+	services := dependsOn(map[string][]string{
+		"default": {"web", "db"},
+		"web":     {"cache", "db"},
+		"db":      nil,
+		"cache":   nil,
+		"worker":  {"db"},
+		"proxy":   nil,
+	})
+	want, err := ServiceStartOrder(services)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		got, err := ServiceStartOrder(services)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("order changed between calls: %q, then %q", want, got)
+		}
+	}
+
+	// Cycles are reported the same way each time too
+	services = dependsOn(map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}, "d": {"c"}})
+	for i := 0; i < 100; i++ {
+		_, err := ServiceStartOrder(services)
+		if err == nil || err.Error() != "dependsOn forms a cycle: a -> b -> c -> a" {
+			t.Fatalf("error = %v, want the cycle from a", err)
+		}
+	}
+}
+
+func TestValidateDependsOn(t *testing.T) {
+	healthcheck := &Healthcheck{Exec: []string{"pg_isready"}}
+
+	tests := []struct {
+		name     string
+		services map[string]ServiceSpec
+		template bool
+		want     field.ErrorList
+	}{
+		{
+			name: "valid",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{
+					{Service: "db", Condition: DependencyHealthy},
+					{Service: "cache", Condition: DependencyStarted},
+				}},
+				"db":    {Image: "postgres", Healthcheck: healthcheck},
+				"cache": {Image: "redis"},
+			},
+		},
+		{
+			name: "self-dependency",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{{Service: "default"}}},
+			},
+			want: field.ErrorList{
+				field.Forbidden(field.NewPath("spec", "services"), "dependsOn forms a cycle: default -> default"),
+			},
+		},
+		{
+			name: "two-node cycle",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{{Service: "db"}}},
+				"db":      {Image: "postgres", DependsOn: []ServiceDependency{{Service: "default"}}},
+			},
+			want: field.ErrorList{
+				field.Forbidden(field.NewPath("spec", "services"), "dependsOn forms a cycle: db -> default -> db"),
+			},
+		},
+		{
+			name: "missing dependency",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{{Service: "db"}}},
+			},
+			want: field.ErrorList{
+				field.NotFound(field.NewPath("spec", "services").Key("default").Child("dependsOn").Index(0).Child("service"), "db"),
+			},
+		},
+		{
+			name: "missing dependency in a template's sandbox",
+			services: map[string]ServiceSpec{
+				"default": {DependsOn: []ServiceDependency{{Service: "db", Condition: DependencyHealthy}}},
+			},
+			template: true,
+		},
+		{
+			name: "healthy without a healthcheck",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{{Service: "db", Condition: DependencyHealthy}}},
+				"db":      {Image: "postgres"},
+			},
+			want: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "services").Key("default").Child("dependsOn").Index(0).Child("condition"),
+					DependencyHealthy, "service db has no healthcheck"),
+			},
+		},
+		{
+			name: "duplicate dependency",
+			services: map[string]ServiceSpec{
+				"default": {Image: "ubuntu", DependsOn: []ServiceDependency{{Service: "db"}, {Service: "db"}}},
+				"db":      {Image: "postgres"},
+			},
+			want: field.ErrorList{
+				field.Duplicate(field.NewPath("spec", "services").Key("default").Child("dependsOn").Index(1).Child("service"), "db"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &InspectSandboxSpec{Services: tt.services}
+			if tt.template {
+				spec.TemplateRef = &TemplateReference{Name: "base"}
+			}
+			got := ValidateInspectSandboxSpec("task", spec, field.NewPath("spec"))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors =\n%s\nwant\n%s", errorLines(got), errorLines(tt.want))
+			}
+		})
+	}
+}
+
+func errorLines(errs field.ErrorList) string {
+	lines := make([]string, 0, len(errs))
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,160 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PoolLabel is set on sandboxes created by a pool to the pool's name
+	PoolLabel = "inspect.example.com/pool"
+
+	// ClaimLabel is set on pooled sandboxes once they are bound, to the
+	// name of the claim that holds them
+	ClaimLabel = "inspect.example.com/claim"
+
+	// ClaimedAtAnnotation records when a pooled sandbox was bound. Heartbeat
+	// timeouts count from then rather than from creation.
+	ClaimedAtAnnotation = "inspect.example.com/claimed-at"
+
+	// TemplateHashAnnotation records the hash of the pool or set template a
+	// sandbox was created from, so it can be brought up to date
+	TemplateHashAnnotation = "inspect.example.com/template-hash"
+)
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxPoolSpec defines the desired state of an InspectSandboxPool
+type InspectSandboxPoolSpec struct {
+	// Replicas is the number of idle sandboxes to keep ready for claims
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// Template is the spec every sandbox in the pool is created with.
+	// Changing it replaces idle sandboxes but leaves claimed ones alone.
+	// TTLs count from when each sandbox was created or became ready, even
+	// while it is idle, but heartbeats are only expected once it is claimed.
+	Template InspectSandboxSpec `json:"template"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxPoolStatus defines the observed state of InspectSandboxPool
+type InspectSandboxPoolStatus struct {
+	// Replicas is the number of idle sandboxes in the pool
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of idle sandboxes ready to be claimed
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// ObservedGeneration is the generation of the spec this status reflects
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=isboxpool
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Idle",type=integer,JSONPath=`.status.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// InspectSandboxPool keeps a number of pre-provisioned sandboxes ready to
+// be handed out by InspectSandboxClaims
+type InspectSandboxPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InspectSandboxPoolSpec   `json:"spec,omitempty"`
+	Status InspectSandboxPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InspectSandboxPoolList contains a list of InspectSandboxPool resources
+type InspectSandboxPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InspectSandboxPool `json:"items"`
+}
+
+// ClaimPhase summarises whether a claim holds a sandbox
+// +kubebuilder:validation:Enum=Pending;Bound;Lost
+type ClaimPhase string
+
+const (
+	// ClaimPending means the claim is waiting for a ready sandbox
+	ClaimPending ClaimPhase = "Pending"
+
+	// ClaimBound means the claim holds a sandbox
+	ClaimBound ClaimPhase = "Bound"
+
+	// ClaimLost means the bound sandbox was deleted from under the claim
+	ClaimLost ClaimPhase = "Lost"
+)
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxClaimSpec defines the desired state of an InspectSandboxClaim
+type InspectSandboxClaimSpec struct {
+	// PoolName is the pool in the claim's namespace to take a sandbox from
+	// +kubebuilder:validation:MinLength=1
+	PoolName string `json:"poolName"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxClaimStatus defines the observed state of InspectSandboxClaim
+type InspectSandboxClaimStatus struct {
+	// Phase summarises whether the claim holds a sandbox
+	// +optional
+	Phase ClaimPhase `json:"phase,omitempty"`
+
+	// SandboxName is the sandbox bound to the claim
+	// +optional
+	SandboxName string `json:"sandboxName,omitempty"`
+
+	// BoundTime is when the sandbox was bound to the claim
+	// +optional
+	BoundTime *metav1.Time `json:"boundTime,omitempty"`
+
+	// Message provides additional status information
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=isboxclaim
+// +kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.poolName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Sandbox",type=string,JSONPath=`.status.sandboxName`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// InspectSandboxClaim takes a ready sandbox from a pool. The sandbox is
+// deleted along with the claim.
+type InspectSandboxClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InspectSandboxClaimSpec   `json:"spec,omitempty"`
+	Status InspectSandboxClaimStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InspectSandboxClaimList contains a list of InspectSandboxClaim resources
+type InspectSandboxClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InspectSandboxClaim `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&InspectSandboxPool{}, &InspectSandboxPoolList{},
+		&InspectSandboxClaim{}, &InspectSandboxClaimList{},
+	)
+}
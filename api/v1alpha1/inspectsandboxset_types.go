@@ -0,0 +1,99 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SetLabel is set on sandboxes created by a set to the set's name
+	SetLabel = "inspect.example.com/set"
+
+	// SetIndexLabel is set on sandboxes created by a set to their index
+	SetIndexLabel = "inspect.example.com/set-index"
+
+	// SetIndexEnvVar is given to every service in a set's template with
+	// the index of the sandbox it runs in, like a Job's completion index
+	SetIndexEnvVar = "INSPECT_SANDBOX_INDEX"
+)
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxSetSpec defines the desired state of an InspectSandboxSet
+type InspectSandboxSetSpec struct {
+	// Replicas is the number of sandboxes, indexed from 0 to replicas-1.
+	// Scaling in deletes the highest indexes first.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// Template is the spec every sandbox in the set is created with. Each
+	// service it lists is given the sandbox's index in the
+	// INSPECT_SANDBOX_INDEX environment variable. Changing it updates every
+	// sandbox in the set.
+	Template InspectSandboxSpec `json:"template"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// InspectSandboxSetStatus defines the observed state of InspectSandboxSet
+type InspectSandboxSetStatus struct {
+	// Replicas is the number of sandboxes the set has created
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of sandboxes in the Ready phase
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// FailedReplicas is the number of sandboxes in the Failed phase
+	// +optional
+	FailedReplicas int32 `json:"failedReplicas,omitempty"`
+
+	// CompletedIndexes are the indexes whose sandboxes expired, through a
+	// TTL or heartbeat timeout. They aren't recreated unless the set is
+	// scaled in past them and out again.
+	// +optional
+	CompletedIndexes []int32 `json:"completedIndexes,omitempty"`
+
+	// ObservedGeneration is the generation of the spec this status reflects
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the set.
+	// Ready is true when every sandbox in the set that hasn't completed is
+	// ready.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas
+// +kubebuilder:resource:scope=Namespaced,shortName=isboxset
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// InspectSandboxSet creates and scales a number of indexed sandboxes from
+// one template
+type InspectSandboxSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InspectSandboxSetSpec   `json:"spec,omitempty"`
+	Status InspectSandboxSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InspectSandboxSetList contains a list of InspectSandboxSet resources
+type InspectSandboxSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InspectSandboxSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InspectSandboxSet{}, &InspectSandboxSetList{})
+}
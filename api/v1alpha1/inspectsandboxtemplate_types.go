@@ -0,0 +1,33 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced,shortName=isboxtemplate
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// InspectSandboxTemplate is a reusable sandbox spec that InspectSandboxes
+// refer to with spec.templateRef. A templateRef within a template is
+// ignored. Suspending is up to each sandbox, so templates can't set suspend.
+type InspectSandboxTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:XValidation:rule="!has(self.suspend) || !self.suspend",message="suspend can only be set on a sandbox, not its template"
+	Spec InspectSandboxSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InspectSandboxTemplateList contains a list of InspectSandboxTemplate resources
+type InspectSandboxTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InspectSandboxTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InspectSandboxTemplate{}, &InspectSandboxTemplateList{})
+}
@@ -10,6 +10,86 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPGetHealthcheck) DeepCopyInto(out *HTTPGetHealthcheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPGetHealthcheck.
+func (in *HTTPGetHealthcheck) DeepCopy() *HTTPGetHealthcheck {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPGetHealthcheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Healthcheck) DeepCopyInto(out *Healthcheck) {
+	*out = *in
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HTTPGet != nil {
+		in, out := &in.HTTPGet, &out.HTTPGet
+		*out = new(HTTPGetHealthcheck)
+		**out = **in
+	}
+	if in.TCPSocket != nil {
+		in, out := &in.TCPSocket, &out.TCPSocket
+		*out = new(TCPSocketHealthcheck)
+		**out = **in
+	}
+	if in.IntervalSeconds != nil {
+		in, out := &in.IntervalSeconds, &out.IntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.StartPeriodSeconds != nil {
+		in, out := &in.StartPeriodSeconds, &out.StartPeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Healthcheck.
+func (in *Healthcheck) DeepCopy() *Healthcheck {
+	if in == nil {
+		return nil
+	}
+	out := new(Healthcheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HeartbeatSpec) DeepCopyInto(out *HeartbeatSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HeartbeatSpec.
+func (in *HeartbeatSpec) DeepCopy() *HeartbeatSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HeartbeatSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InspectSandbox) DeepCopyInto(out *InspectSandbox) {
 	*out = *in
@@ -37,6 +117,99 @@ func (in *InspectSandbox) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxClaim) DeepCopyInto(out *InspectSandboxClaim) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxClaim.
+func (in *InspectSandboxClaim) DeepCopy() *InspectSandboxClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxClaim) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxClaimList) DeepCopyInto(out *InspectSandboxClaimList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InspectSandboxClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxClaimList.
+func (in *InspectSandboxClaimList) DeepCopy() *InspectSandboxClaimList {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxClaimList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxClaimList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxClaimSpec) DeepCopyInto(out *InspectSandboxClaimSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxClaimSpec.
+func (in *InspectSandboxClaimSpec) DeepCopy() *InspectSandboxClaimSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxClaimSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxClaimStatus) DeepCopyInto(out *InspectSandboxClaimStatus) {
+	*out = *in
+	if in.BoundTime != nil {
+		in, out := &in.BoundTime, &out.BoundTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxClaimStatus.
+func (in *InspectSandboxClaimStatus) DeepCopy() *InspectSandboxClaimStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxClaimStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InspectSandboxList) DeepCopyInto(out *InspectSandboxList) {
 	*out = *in
@@ -69,9 +242,206 @@ func (in *InspectSandboxList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxPool) DeepCopyInto(out *InspectSandboxPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxPool.
+func (in *InspectSandboxPool) DeepCopy() *InspectSandboxPool {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxPoolList) DeepCopyInto(out *InspectSandboxPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InspectSandboxPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxPoolList.
+func (in *InspectSandboxPoolList) DeepCopy() *InspectSandboxPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxPoolSpec) DeepCopyInto(out *InspectSandboxPoolSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxPoolSpec.
+func (in *InspectSandboxPoolSpec) DeepCopy() *InspectSandboxPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxPoolStatus) DeepCopyInto(out *InspectSandboxPoolStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxPoolStatus.
+func (in *InspectSandboxPoolStatus) DeepCopy() *InspectSandboxPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxSet) DeepCopyInto(out *InspectSandboxSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxSet.
+func (in *InspectSandboxSet) DeepCopy() *InspectSandboxSet {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxSetList) DeepCopyInto(out *InspectSandboxSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InspectSandboxSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxSetList.
+func (in *InspectSandboxSetList) DeepCopy() *InspectSandboxSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxSetSpec) DeepCopyInto(out *InspectSandboxSetSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxSetSpec.
+func (in *InspectSandboxSetSpec) DeepCopy() *InspectSandboxSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxSetStatus) DeepCopyInto(out *InspectSandboxSetStatus) {
+	*out = *in
+	if in.CompletedIndexes != nil {
+		in, out := &in.CompletedIndexes, &out.CompletedIndexes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxSetStatus.
+func (in *InspectSandboxSetStatus) DeepCopy() *InspectSandboxSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InspectSandboxSpec) DeepCopyInto(out *InspectSandboxSpec) {
 	*out = *in
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
 	if in.Services != nil {
 		in, out := &in.Services, &out.Services
 		*out = make(map[string]ServiceSpec, len(*in))
@@ -95,9 +465,34 @@ func (in *InspectSandboxSpec) DeepCopyInto(out *InspectSandboxSpec) {
 		in, out := &in.Volumes, &out.Volumes
 		*out = make(map[string]VolumeSpec, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.FailureGracePeriodSeconds != nil {
+		in, out := &in.FailureGracePeriodSeconds, &out.FailureGracePeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTLSecondsAfterCreation != nil {
+		in, out := &in.TTLSecondsAfterCreation, &out.TTLSecondsAfterCreation
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTLSecondsAfterReady != nil {
+		in, out := &in.TTLSecondsAfterReady, &out.TTLSecondsAfterReady
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Heartbeat != nil {
+		in, out := &in.Heartbeat, &out.Heartbeat
+		*out = new(HeartbeatSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxSpec.
@@ -124,9 +519,22 @@ func (in *InspectSandboxStatus) DeepCopyInto(out *InspectSandboxStatus) {
 		in, out := &in.Services, &out.Services
 		*out = make(map[string]ServiceStatus, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.LastHeartbeatTime != nil {
+		in, out := &in.LastHeartbeatTime, &out.LastHeartbeatTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FirstReadyTime != nil {
+		in, out := &in.FirstReadyTime, &out.FirstReadyTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(TemplateSnapshot)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxStatus.
@@ -139,6 +547,94 @@ func (in *InspectSandboxStatus) DeepCopy() *InspectSandboxStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxTemplate) DeepCopyInto(out *InspectSandboxTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxTemplate.
+func (in *InspectSandboxTemplate) DeepCopy() *InspectSandboxTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InspectSandboxTemplateList) DeepCopyInto(out *InspectSandboxTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InspectSandboxTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InspectSandboxTemplateList.
+func (in *InspectSandboxTemplateList) DeepCopy() *InspectSandboxTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectSandboxTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InspectSandboxTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceDependency) DeepCopyInto(out *ServiceDependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceDependency.
+func (in *ServiceDependency) DeepCopy() *ServiceDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServicePort) DeepCopyInto(out *ServicePort) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServicePort.
+func (in *ServicePort) DeepCopy() *ServicePort {
+	if in == nil {
+		return nil
+	}
+	out := new(ServicePort)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
 	*out = *in
@@ -152,6 +648,11 @@ func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DNSRecord != nil {
+		in, out := &in.DNSRecord, &out.DNSRecord
+		*out = new(bool)
+		**out = **in
+	}
 	if in.AdditionalDNSRecords != nil {
 		in, out := &in.AdditionalDNSRecords, &out.AdditionalDNSRecords
 		*out = make([]string, len(*in))
@@ -175,6 +676,21 @@ func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]ServicePort, len(*in))
+		copy(*out, *in)
+	}
+	if in.Healthcheck != nil {
+		in, out := &in.Healthcheck, &out.Healthcheck
+		*out = new(Healthcheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]ServiceDependency, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSpec.
@@ -190,6 +706,15 @@ func (in *ServiceSpec) DeepCopy() *ServiceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceStatus) DeepCopyInto(out *ServiceStatus) {
 	*out = *in
+	if in.DNSNames != nil {
+		in, out := &in.DNSNames, &out.DNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailingSince != nil {
+		in, out := &in.FailingSince, &out.FailingSince
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceStatus.
@@ -202,9 +727,60 @@ func (in *ServiceStatus) DeepCopy() *ServiceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TCPSocketHealthcheck) DeepCopyInto(out *TCPSocketHealthcheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TCPSocketHealthcheck.
+func (in *TCPSocketHealthcheck) DeepCopy() *TCPSocketHealthcheck {
+	if in == nil {
+		return nil
+	}
+	out := new(TCPSocketHealthcheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateSnapshot) DeepCopyInto(out *TemplateSnapshot) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateSnapshot.
+func (in *TemplateSnapshot) DeepCopy() *TemplateSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VolumeSpec) DeepCopyInto(out *VolumeSpec) {
 	*out = *in
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]v1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSpec.
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+	"github.com/example/inspect-operator/controllers"
+)
+
+// errDifferences is returned when the rendered objects differ from the
+// cluster, so isboxctl exits 1 like kubectl diff
+var errDifferences = errors.New("rendered objects differ from the cluster")
+
+// runDiff compares the child objects the operator would apply for each
+// sandbox with what is in the cluster. Each object is applied with a
+// server-side dry run, so the diff shows exactly what the operator would
+// change once defaults and other field managers are taken into account.
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	render := addRenderFlags(flags, "",
+		"The address sandbox DNS resolvers forward queries to. Defaults to the kube-system/kube-dns Service IP.")
+	kubeContext := flags.String("context", "", "The kubeconfig context to use.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: isboxctl diff [flags] [manifest.yaml...]")
+		fmt.Fprintln(flags.Output(), "\nTemplates missing from the given manifests are read from the cluster.")
+		fmt.Fprintln(flags.Output(), "Exits 1 if anything would change.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	m, err := readManifests(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfigWithContext(*kubeContext)
+	if err != nil {
+		return err
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(inspectv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(ciliumv2.AddToScheme(scheme))
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if render.clusterDNS == "" {
+		var kubeDNS corev1.Service
+		if err := c.Get(ctx, types.NamespacedName{Name: "kube-dns", Namespace: "kube-system"}, &kubeDNS); err != nil {
+			return fmt.Errorf("looking up cluster DNS service, set -cluster-dns instead: %w", err)
+		}
+		render.clusterDNS = kubeDNS.Spec.ClusterIP
+	}
+
+	differ := &differ{client: c, scheme: scheme}
+	for i := range m.sandboxes {
+		sandbox := &m.sandboxes[i]
+		if sandbox.Namespace == "" {
+			sandbox.Namespace = render.namespace
+		}
+		templates, err := differ.templates(ctx, sandbox, m.templates)
+		if err != nil {
+			return err
+		}
+		opts, err := render.options(templates)
+		if err != nil {
+			return err
+		}
+		if err := differ.diffSandbox(ctx, sandbox, opts); err != nil {
+			return fmt.Errorf("diffing sandbox %s: %w", sandbox.Name, err)
+		}
+	}
+
+	if differ.changed > 0 {
+		return errDifferences
+	}
+	return nil
+}
+
+// differ diffs rendered objects against a cluster
+type differ struct {
+	client  client.Client
+	scheme  *runtime.Scheme
+	changed int
+}
+
+// templates returns the given templates, plus the one the sandbox refers
+// to from the cluster if it wasn't given. A template missing from the
+// cluster is left out, so the sandbox is built from its snapshot if it has
+// one.
+func (d *differ) templates(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	given []inspectv1alpha1.InspectSandboxTemplate,
+) ([]inspectv1alpha1.InspectSandboxTemplate, error) {
+	ref := sandbox.Spec.TemplateRef
+	if ref == nil {
+		return given, nil
+	}
+	for _, template := range given {
+		if template.Name == ref.Name {
+			return given, nil
+		}
+	}
+
+	var template inspectv1alpha1.InspectSandboxTemplate
+	err := d.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: sandbox.Namespace}, &template)
+	if apierrors.IsNotFound(err) {
+		return given, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading template %s: %w", ref.Name, err)
+	}
+	return append(given, template), nil
+}
+
+// diffSandbox prints a diff for every rendered object that would change
+func (d *differ) diffSandbox(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	opts controllers.RenderOptions,
+) error {
+	// Child objects are owned by the live sandbox, whose status also
+	// decides whether services are scaled down
+	var live inspectv1alpha1.InspectSandbox
+	err := d.client.Get(ctx, client.ObjectKeyFromObject(sandbox), &live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists {
+		sandbox.UID = live.UID
+		sandbox.Status = live.Status
+	}
+
+	objects, err := controllers.RenderSandbox(sandbox, opts)
+	if err != nil {
+		return err
+	}
+
+	rendered := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		obj.SetNamespace(sandbox.Namespace)
+		if exists {
+			if err := controllerutil.SetControllerReference(&live, obj, d.scheme); err != nil {
+				return err
+			}
+		}
+		if err := d.diffObject(ctx, obj); err != nil {
+			return err
+		}
+		key, err := d.objectName(obj)
+		if err != nil {
+			return err
+		}
+		rendered[key] = true
+	}
+
+	if !exists {
+		return nil
+	}
+	spec, err := controllers.SandboxSpec(sandbox, opts)
+	if err != nil {
+		return err
+	}
+	return d.diffPruned(ctx, &live, rendered, spec.VolumeRetentionPolicy == inspectv1alpha1.VolumeRetentionRetain)
+}
+
+// diffPruned prints the child objects of the live sandbox that are no
+// longer rendered, which the operator would delete. Volume claims kept by
+// the Retain policy are shown losing their owner reference instead.
+func (d *differ) diffPruned(
+	ctx context.Context,
+	live *inspectv1alpha1.InspectSandbox,
+	rendered map[string]bool,
+	retainVolumes bool,
+) error {
+	lists := []client.ObjectList{
+		&appsv1.StatefulSetList{},
+		&corev1.ServiceList{},
+		&corev1.ConfigMapList{},
+		&corev1.PersistentVolumeClaimList{},
+		&ciliumv2.CiliumNetworkPolicyList{},
+		&networkingv1.NetworkPolicyList{},
+	}
+	for _, list := range lists {
+		err := d.client.List(ctx, list,
+			client.InNamespace(live.Namespace),
+			client.MatchingLabels{
+				"app.kubernetes.io/instance":   live.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+			},
+		)
+		if meta.IsNoMatchError(err) {
+			// Cilium isn't installed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj := item.(client.Object)
+			name, err := d.objectName(obj)
+			if err != nil {
+				return err
+			}
+			if rendered[name] || !metav1.IsControlledBy(obj, live) || !obj.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+
+			currentYAML, err := diffableYAML(obj)
+			if err != nil {
+				return err
+			}
+			prunedYAML := ""
+			if _, ok := obj.(*corev1.PersistentVolumeClaim); ok && retainVolumes {
+				retained := obj.DeepCopyObject().(client.Object)
+				if err := controllerutil.RemoveControllerReference(live, retained, d.scheme); err != nil {
+					return err
+				}
+				if prunedYAML, err = diffableYAML(retained); err != nil {
+					return err
+				}
+			}
+			d.changed++
+			fmt.Fprint(os.Stdout, unifiedDiff(currentYAML, prunedYAML, "live/"+name, "rendered/"+name))
+		}
+	}
+	return nil
+}
+
+// objectName returns obj's kind, namespace and name, as used in diff
+// headers
+func (d *differ) objectName(obj client.Object) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, d.scheme)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName()), nil
+}
+
+// diffObject prints how applying obj would change the cluster
+func (d *differ) diffObject(ctx context.Context, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, d.scheme)
+	if err != nil {
+		return err
+	}
+	name, err := d.objectName(obj)
+	if err != nil {
+		return err
+	}
+
+	current, err := d.scheme.New(gvk)
+	if err != nil {
+		return err
+	}
+	currentYAML := ""
+	err = d.client.Get(ctx, client.ObjectKeyFromObject(obj), current.(client.Object))
+	switch {
+	case err == nil:
+		if currentYAML, err = diffableYAML(current); err != nil {
+			return err
+		}
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	applied := obj.DeepCopyObject().(client.Object)
+	if err := d.client.Patch(ctx, applied, client.Apply, client.DryRunAll,
+		controllers.FieldOwner, client.ForceOwnership); err != nil {
+		return fmt.Errorf("dry-run applying %s: %w", name, err)
+	}
+	appliedYAML, err := diffableYAML(applied)
+	if err != nil {
+		return err
+	}
+
+	if currentYAML == appliedYAML {
+		return nil
+	}
+	d.changed++
+	fmt.Fprint(os.Stdout, unifiedDiff(currentYAML, appliedYAML, "live/"+name, "rendered/"+name))
+	return nil
+}
+
+// diffableYAML renders obj without the fields the server changes on every
+// write, which would otherwise show up in every diff
+func diffableYAML(obj runtime.Object) (string, error) {
+	manifest, err := toMap(obj)
+	if err != nil {
+		return "", err
+	}
+	delete(manifest, "status")
+	if metadata, ok := manifest["metadata"].(map[string]interface{}); ok {
+		for _, key := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp"} {
+			delete(metadata, key)
+		}
+	}
+	data, err := yaml.Marshal(manifest)
+	return string(data), err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+	"github.com/example/inspect-operator/pkg/compose"
+)
+
+// runImport converts a compose file into an InspectSandbox manifest,
+// printing a warning for everything that couldn't be carried over
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	name := flags.String("name", "sandbox", "Name of the InspectSandbox.")
+	namespace := flags.String("namespace", "", "Namespace of the InspectSandbox, if any.")
+	output := flags.String("o", "-", "File to write the manifest to, or - for standard output.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: isboxctl import [flags] [compose.yaml]")
+		fmt.Fprintln(flags.Output(), "\nReads compose.yaml by default, or standard input if the file is -.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one compose file")
+	}
+
+	path := "compose.yaml"
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return err
+	}
+
+	spec, warnings, err := compose.Convert(data)
+	if err != nil {
+		return err
+	}
+	for _, fieldErr := range inspectv1alpha1.ValidateInspectSandboxSpec(*name, spec, field.NewPath("spec")) {
+		warnings = append(warnings, fieldErr.Error())
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+
+	sandbox := inspectv1alpha1.InspectSandbox{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: inspectv1alpha1.GroupVersion.String(),
+			Kind:       "InspectSandbox",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      *name,
+			Namespace: *namespace,
+		},
+		Spec: *spec,
+	}
+	manifest, err := marshalManifest(&sandbox)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, manifest)
+}
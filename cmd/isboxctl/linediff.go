@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// unifiedDiff returns a unified diff turning from into to, or an empty
+// string if they are the same. An empty from or to is shown as /dev/null,
+// as for a created or deleted file.
+func unifiedDiff(from, to, fromName, toName string) string {
+	if from == to {
+		return ""
+	}
+	if from == "" {
+		fromName = "/dev/null"
+	}
+	if to == "" {
+		toName = "/dev/null"
+	}
+
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table into a list of kept, removed and added lines
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	// Group changes less than two contexts apart into hunks
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	fromLine, toLine := 1, 1
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			fromLine++
+			toLine++
+			k++
+			continue
+		}
+
+		start := max(0, k-diffContext)
+		end := k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end = min(len(lines), end+diffContext)
+				break
+			}
+			end = next
+		}
+
+		hunkFrom, hunkTo := fromLine-(k-start), toLine-(k-start)
+		fromCount, toCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				fromCount++
+			}
+			if l.op != '-' {
+				toCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunkFrom, fromCount), hunkRange(hunkTo, toCount))
+		for _, l := range lines[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		}
+
+		fromLine += fromCount - (k - start)
+		toLine += toCount - (k - start)
+		k = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side starts at the line before it, as in diff -u.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits s into lines, without a trailing empty line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{
+			name: "unchanged",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "created",
+			from: "",
+			to:   "a\nb\n",
+			want: "--- /dev/null\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deleted",
+			from: "a\n",
+			to:   "",
+			want: "--- old\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "changed line with context",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name: "distant changes get their own hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			to:   "1\ntwo\n3\n4\n5\n6\n7\n8\n9\nten\n11\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -7,5 +7,5 @@\n 7\n 8\n 9\n-10\n+ten\n 11\n",
+		},
+		{
+			name: "lines added and removed",
+			from: "a\nb\nc\n",
+			to:   "a\nc\nd\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n c\n+d\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.from, tt.to, "old", "new"); got != tt.want {
+				t.Errorf("diff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{start: 3, count: 1, want: "3"},
+		{start: 3, count: 4, want: "3,4"},
+		{start: 1, count: 0, want: "0,0"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
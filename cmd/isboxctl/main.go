@@ -0,0 +1,55 @@
+// Command isboxctl works with InspectSandbox manifests outside the cluster
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// commands are the subcommands isboxctl understands
+var commands = map[string]func(args []string) error{
+	"import": runImport,
+	"render": runRender,
+	"diff":   runDiff,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "isboxctl: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	err := run(os.Args[2:])
+	if errors.Is(err, errDifferences) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "isboxctl %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the available subcommands
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: isboxctl <command> [flags] [args]
+
+Commands:
+  import    Convert a compose file into an InspectSandbox manifest
+  render    Print the objects the operator would create for a sandbox
+  diff      Compare those objects with what is in the cluster
+
+Run isboxctl <command> -h for the flags of a command.
+`)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+	"github.com/example/inspect-operator/controllers"
+)
+
+// manifests are the sandboxes and templates read from manifest files
+type manifests struct {
+	sandboxes []inspectv1alpha1.InspectSandbox
+	templates []inspectv1alpha1.InspectSandboxTemplate
+}
+
+// readManifests reads every InspectSandbox and InspectSandboxTemplate in
+// the given files, or standard input if there are none. Other kinds are
+// skipped, so a file can hold a whole task's manifests.
+func readManifests(paths []string) (*manifests, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	m := &manifests{}
+	for _, path := range paths {
+		data, err := readInput(path)
+		if err != nil {
+			return nil, err
+		}
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+		for {
+			doc, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if err := m.add(doc); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if len(m.sandboxes) == 0 {
+		return nil, fmt.Errorf("no InspectSandbox found in %v", paths)
+	}
+	return m, nil
+}
+
+// add decodes doc if it is a sandbox or template
+func (m *manifests) add(doc []byte) error {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+		return err
+	}
+	if typeMeta.APIVersion != inspectv1alpha1.GroupVersion.String() {
+		return nil
+	}
+
+	switch typeMeta.Kind {
+	case "InspectSandbox":
+		var sandbox inspectv1alpha1.InspectSandbox
+		if err := yaml.UnmarshalStrict(doc, &sandbox); err != nil {
+			return err
+		}
+		m.sandboxes = append(m.sandboxes, sandbox)
+	case "InspectSandboxTemplate":
+		var template inspectv1alpha1.InspectSandboxTemplate
+		if err := yaml.UnmarshalStrict(doc, &template); err != nil {
+			return err
+		}
+		m.templates = append(m.templates, template)
+	}
+	return nil
+}
+
+// renderFlags are the operator settings rendering depends on
+type renderFlags struct {
+	namespace     string
+	clusterDomain string
+	clusterDNS    string
+	backend       string
+
+	defaultRuntimeClass string
+	defaultCPU          string
+	defaultMemory       string
+}
+
+// addRenderFlags registers the render flags on flags, with clusterDNS as
+// the default cluster DNS address
+func addRenderFlags(flags *flag.FlagSet, clusterDNS, clusterDNSHelp string) *renderFlags {
+	f := &renderFlags{}
+	flags.StringVar(&f.namespace, "namespace", "default", "Namespace of sandboxes that don't set one.")
+	flags.StringVar(&f.clusterDomain, "cluster-domain", "cluster.local", "The DNS domain of the cluster.")
+	flags.StringVar(&f.clusterDNS, "cluster-dns", clusterDNS, clusterDNSHelp)
+	flags.StringVar(&f.backend, "network-policy-backend", string(controllers.NetworkPolicyBackendCilium),
+		"Kind of network policies to render: cilium or kubernetes.")
+	flags.StringVar(&f.defaultRuntimeClass, "default-runtime-class", "",
+		"The operator's --default-runtime-class, applied to sandboxes built from a template.")
+	flags.StringVar(&f.defaultCPU, "default-cpu", "",
+		"The operator's --default-cpu, applied to sandboxes built from a template.")
+	flags.StringVar(&f.defaultMemory, "default-memory", "",
+		"The operator's --default-memory, applied to sandboxes built from a template.")
+	return f
+}
+
+// options returns the render options the flags describe
+func (f *renderFlags) options(templates []inspectv1alpha1.InspectSandboxTemplate) (controllers.RenderOptions, error) {
+	backend := controllers.NetworkPolicyBackend(f.backend)
+	switch backend {
+	case controllers.NetworkPolicyBackendCilium, controllers.NetworkPolicyBackendKubernetes:
+	default:
+		return controllers.RenderOptions{}, fmt.Errorf("invalid -network-policy-backend %q, expected cilium or kubernetes", f.backend)
+	}
+
+	defaulter := &inspectv1alpha1.InspectSandboxDefaulter{RuntimeClassName: f.defaultRuntimeClass}
+	if err := defaulter.SetDefaultResource(corev1.ResourceCPU, f.defaultCPU); err != nil {
+		return controllers.RenderOptions{}, fmt.Errorf("invalid -default-cpu: %w", err)
+	}
+	if err := defaulter.SetDefaultResource(corev1.ResourceMemory, f.defaultMemory); err != nil {
+		return controllers.RenderOptions{}, fmt.Errorf("invalid -default-memory: %w", err)
+	}
+
+	return controllers.RenderOptions{
+		ClusterDomain:        f.clusterDomain,
+		ClusterDNS:           f.clusterDNS,
+		NetworkPolicyBackend: backend,
+		Templates:            templates,
+		Defaulter:            defaulter,
+	}, nil
+}
+
+// marshalManifest renders obj as YAML without the empty status and
+// creationTimestamp a freshly built object carries
+func marshalManifest(obj interface{}) ([]byte, error) {
+	manifest, err := toMap(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(manifest, "status")
+	if metadata, ok := manifest["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(manifest)
+}
+
+// toMap converts obj to its generic JSON form
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]interface{}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readInput reads path, or standard input if path is -
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes data to path, or standard output if path is -
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+
+	"github.com/example/inspect-operator/controllers"
+)
+
+// runRender prints the child objects the operator would create for each
+// sandbox in the given manifests
+func runRender(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	render := addRenderFlags(flags, "10.96.0.10",
+		"The address sandbox DNS resolvers forward queries to. Defaults to kubeadm's kube-dns address.")
+	output := flags.String("o", "-", "File to write the objects to, or - for standard output.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: isboxctl render [flags] [manifest.yaml...]")
+		fmt.Fprintln(flags.Output(), "\nTemplates named by a sandbox's templateRef must be in the given manifests.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	m, err := readManifests(flags.Args())
+	if err != nil {
+		return err
+	}
+	opts, err := render.options(m.templates)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for i := range m.sandboxes {
+		sandbox := &m.sandboxes[i]
+		if sandbox.Namespace == "" {
+			sandbox.Namespace = render.namespace
+		}
+		objects, err := controllers.RenderSandbox(sandbox, opts)
+		if err != nil {
+			return fmt.Errorf("rendering sandbox %s: %w", sandbox.Name, err)
+		}
+		for _, obj := range objects {
+			manifest, err := marshalManifest(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&out, "---\n# Source: InspectSandbox %s\n", sandbox.Name)
+			out.Write(manifest)
+		}
+	}
+	return writeOutput(*output, out.Bytes())
+}
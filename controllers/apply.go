@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// FieldOwner is the field manager the operator applies child objects as
+const FieldOwner = client.FieldOwner("inspect-operator")
+
+// applyObject server-side applies obj as owned by the sandbox. Only the
+// fields set in obj are managed, so fields other controllers set are left
+// alone, and the API server skips the write if nothing changed. obj must
+// have its TypeMeta set and is updated with the result.
+func (r *InspectSandboxReconciler) applyObject(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	obj client.Object,
+) error {
+	if err := controllerutil.SetControllerReference(sandbox, obj, r.Scheme); err != nil {
+		return err
+	}
+
+	// Note what the operator last applied so changes made by this apply can
+	// be reported. The resourceVersion can't be used, as it also moves when
+	// other controllers write status or fields the operator doesn't own.
+	existing := obj.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	if err := r.Patch(ctx, obj, client.Apply, FieldOwner, client.ForceOwnership); err != nil {
+		return err
+	}
+
+	switch {
+	case !found:
+		childObjectOperations.WithLabelValues(r.objectKind(obj), "create").Inc()
+		if !r.recordDrift(sandbox, obj, "deleted") {
+			r.Recorder.Eventf(sandbox, corev1.EventTypeNormal, eventReasonCreated,
+				"Created %s %s", r.objectKind(obj), obj.GetName())
+		}
+	case obj.GetGeneration() != existing.GetGeneration() ||
+		!equality.Semantic.DeepEqual(appliedFields(obj), appliedFields(existing)):
+		childObjectOperations.WithLabelValues(r.objectKind(obj), "update").Inc()
+		if !r.recordDrift(sandbox, obj, "modified") {
+			r.Recorder.Eventf(sandbox, corev1.EventTypeNormal, eventReasonUpdated,
+				"Updated %s %s", r.objectKind(obj), obj.GetName())
+		}
+	}
+	return nil
+}
+
+// appliedFields returns the managedFields entry for the operator's applies
+// to obj, or nil if it has never applied it. The API server moves its
+// timestamp whenever an apply changes the object, including setting fields
+// back to the applied values after someone else changed them.
+func appliedFields(obj client.Object) *metav1.ManagedFieldsEntry {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == string(FieldOwner) && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return &entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// emulateApply emulates server-side apply, which the fake client doesn't
+// support. Applied fields are merged into the live object, replacing lists
+// whole, and status is left alone. An apply that changes anything writes the
+// object and moves the operator's managedFields timestamp on by a second;
+// one that changes nothing leaves the object alone.
+func emulateApply() interceptor.Funcs {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			gvk := obj.GetObjectKind().GroupVersionKind()
+			now = now.Add(time.Second)
+			entry := metav1.ManagedFieldsEntry{
+				Manager:    string(FieldOwner),
+				Operation:  metav1.ManagedFieldsOperationApply,
+				APIVersion: gvk.GroupVersion().String(),
+				Time:       &metav1.Time{Time: now},
+			}
+
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(gvk)
+			err := c.Get(ctx, client.ObjectKeyFromObject(obj), live)
+			switch {
+			case apierrors.IsNotFound(err):
+				obj.SetManagedFields([]metav1.ManagedFieldsEntry{entry})
+				return c.Create(ctx, obj)
+			case err != nil:
+				return err
+			}
+
+			applied, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+			if err != nil {
+				return err
+			}
+			delete(applied, "status")
+			unstructured.RemoveNestedField(applied, "metadata", "creationTimestamp")
+			if mergeApplied(live.Object, applied) {
+				live.SetManagedFields([]metav1.ManagedFieldsEntry{entry})
+				if err := c.Update(ctx, live); err != nil {
+					return err
+				}
+			}
+			return c.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		},
+	}
+}
+
+// mergeApplied sets the applied fields on live, returning whether any
+// changed
+func mergeApplied(live, applied map[string]interface{}) bool {
+	changed := false
+	for key, value := range applied {
+		if fields, ok := value.(map[string]interface{}); ok {
+			if liveFields, ok := live[key].(map[string]interface{}); ok {
+				changed = mergeApplied(liveFields, fields) || changed
+				continue
+			}
+		}
+		if !equality.Semantic.DeepEqual(live[key], value) {
+			live[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+func TestApplyObject(t *testing.T) {
+	sandbox := newDNSSandbox(nil)
+	sandbox.UID = "task-uid"
+	recorder := record.NewFakeRecorder(10)
+	// during runs after applyObject has read the ConfigMap but before it
+	// applies, as a write racing with the apply would
+	var during func()
+	funcs := emulateApply()
+	c := interceptor.NewClient(newFakeClient(sandbox), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if during != nil {
+				during()
+				during = nil
+			}
+			return funcs.Patch(ctx, c, obj, patch, opts...)
+		},
+	})
+	r := &InspectSandboxReconciler{Client: c, Scheme: testScheme, Recorder: recorder}
+	key := client.ObjectKey{Name: "task-config", Namespace: "evals"}
+
+	apply := func(data string) {
+		t.Helper()
+		configMap := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data:       map[string]string{"config": data},
+		}
+		if err := r.applyObject(context.Background(), sandbox, configMap); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	modify := func(change func(configMap *corev1.ConfigMap)) {
+		t.Helper()
+		var configMap corev1.ConfigMap
+		if err := c.Get(context.Background(), key, &configMap); err != nil {
+			t.Fatal(err)
+		}
+		change(&configMap)
+		if err := c.Update(context.Background(), &configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		before    func()
+		during    func()
+		observed  bool
+		data      string
+		wantEvent string
+	}{
+		{
+			name:      "created",
+			data:      "a",
+			wantEvent: "Normal Created Created ConfigMap task-config",
+		},
+		{
+			name: "unchanged",
+			data: "a",
+		},
+		{
+			name: "fields the operator doesn't own changed",
+			before: func() {
+				modify(func(configMap *corev1.ConfigMap) { configMap.Labels = map[string]string{"team": "evals"} })
+			},
+			observed: true,
+			data:     "a",
+		},
+		{
+			name: "fields the operator doesn't own changed while applying",
+			during: func() {
+				modify(func(configMap *corev1.ConfigMap) { configMap.Labels["owner"] = "someone" })
+			},
+			observed: true,
+			data:     "a",
+		},
+		{
+			name:      "applied fields changed",
+			data:      "b",
+			wantEvent: "Normal Updated Updated ConfigMap task-config",
+		},
+		{
+			name: "applied fields changed outside the operator",
+			before: func() {
+				modify(func(configMap *corev1.ConfigMap) { configMap.Data["config"] = "edited" })
+			},
+			observed:  true,
+			data:      "b",
+			wantEvent: "Warning DriftCorrected ConfigMap task-config was modified outside the operator and has been restored",
+		},
+	}
+
+	// The cases run in order against the same ConfigMap
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+		during = tt.during
+		// An observed sandbox's spec is unchanged, so changes count as drift
+		sandbox.Generation, sandbox.Status.ObservedGeneration = 1, 0
+		if tt.observed {
+			sandbox.Status.ObservedGeneration = 1
+		}
+		drift := sandbox.Status.DriftCorrected
+		apply(tt.data)
+
+		select {
+		case event := <-recorder.Events:
+			if event != tt.wantEvent {
+				t.Errorf("%s: event = %q, want %q", tt.name, event, tt.wantEvent)
+			}
+		default:
+			if tt.wantEvent != "" {
+				t.Errorf("%s: no event, want %q", tt.name, tt.wantEvent)
+			}
+		}
+		wantDrift := drift
+		if tt.observed && tt.wantEvent != "" {
+			wantDrift++
+		}
+		if sandbox.Status.DriftCorrected != wantDrift {
+			t.Errorf("%s: driftCorrected = %d, want %d", tt.name, sandbox.Status.DriftCorrected, wantDrift)
+		}
+	}
+}
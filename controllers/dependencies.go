@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// waitForDependencies reports whether the service's StatefulSet should be
+// held back because services it depends on aren't up yet, recording what
+// it is waiting for in the service's status. Dependencies only order
+// creation, so a service whose StatefulSet exists is never held back.
+// Services are reconciled after their dependencies, so their status is
+// current.
+func (r *InspectSandboxReconciler) waitForDependencies(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	svcName string,
+	svcSpec inspectv1alpha1.ServiceSpec,
+) (bool, error) {
+	if len(svcSpec.DependsOn) == 0 {
+		return false, nil
+	}
+
+	var sts appsv1.StatefulSet
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%s", sandbox.Name, svcName),
+		Namespace: sandbox.Namespace,
+	}, &sts)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	var waitingFor []string
+	for _, dep := range svcSpec.DependsOn {
+		if !dependencyMet(sandbox.Status.Services[dep.Service], dep.Condition) {
+			waitingFor = append(waitingFor, dependencyDescription(dep))
+		}
+	}
+	if len(waitingFor) == 0 {
+		return false, nil
+	}
+
+	sandbox.Status.Services[svcName] = inspectv1alpha1.ServiceStatus{
+		Ready:   false,
+		Reason:  inspectv1alpha1.ServiceReasonWaitingForDependency,
+		Message: fmt.Sprintf("Waiting for %s", strings.Join(waitingFor, ", ")),
+	}
+	return true, nil
+}
+
+// dependencyMet reports whether a dependency with the given status
+// satisfies condition
+func dependencyMet(status inspectv1alpha1.ServiceStatus, condition inspectv1alpha1.DependencyCondition) bool {
+	if condition == inspectv1alpha1.DependencyHealthy {
+		return status.Ready
+	}
+	return status.Started || status.Ready
+}
+
+// dependencyDescription describes what a dependency is waiting for, e.g.
+// "db to be healthy"
+func dependencyDescription(dep inspectv1alpha1.ServiceDependency) string {
+	if dep.Condition == inspectv1alpha1.DependencyHealthy {
+		return fmt.Sprintf("%s to be healthy", dep.Service)
+	}
+	return fmt.Sprintf("%s to start", dep.Service)
+}
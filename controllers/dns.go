@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+const (
+	// dnsResolverImage is the CoreDNS image run alongside each service to
+	// resolve the sandbox's service names and aliases
+	dnsResolverImage = "registry.k8s.io/coredns/coredns:v1.11.3"
+
+	// dnsResolverContainerName is the name of the resolver sidecar container
+	dnsResolverContainerName = "dns-resolver"
+
+	// dnsConfigVolumeName is the pod volume holding the resolver's Corefile
+	dnsConfigVolumeName = "dns-config"
+
+	// dnsConfigMountPath is where the Corefile is mounted in the sidecar
+	dnsConfigMountPath = "/etc/coredns"
+
+	// defaultClusterDomain is used when the reconciler isn't configured with one
+	defaultClusterDomain = "cluster.local"
+)
+
+// sandboxUsesDNSResolver reports whether pods in the sandbox need the
+// resolver sidecar, which is the case when any service publishes a name
+func sandboxUsesDNSResolver(sandbox *inspectv1alpha1.InspectSandbox) bool {
+	for _, svcSpec := range sandbox.Spec.Services {
+		if dnsRecordEnabled(svcSpec) || len(svcSpec.AdditionalDNSRecords) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxDNSAliases maps each name published in the sandbox to the service
+// it resolves to, rejecting invalid or duplicate names. Services with
+// DNSRecord unset or true are reachable by their own name, as under docker
+// compose.
+func sandboxDNSAliases(sandbox *inspectv1alpha1.InspectSandbox) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for svcName, svcSpec := range sandbox.Spec.Services {
+		names := svcSpec.AdditionalDNSRecords
+		if dnsRecordEnabled(svcSpec) {
+			names = append([]string{svcName}, names...)
+		}
+		for _, alias := range names {
+			alias = strings.TrimSuffix(alias, ".")
+			if errs := validation.IsDNS1123Subdomain(alias); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid DNS record %q for service %s: %s", alias, svcName, strings.Join(errs, ", "))
+			}
+			if other, ok := aliases[alias]; ok && other != svcName {
+				return nil, fmt.Errorf("DNS record %q is claimed by both %s and %s", alias, other, svcName)
+			}
+			aliases[alias] = svcName
+		}
+	}
+	return aliases, nil
+}
+
+// dnsRecordEnabled reports whether the service's own name should resolve,
+// which it does unless the service opts out
+func dnsRecordEnabled(svcSpec inspectv1alpha1.ServiceSpec) bool {
+	return svcSpec.DNSRecord == nil || *svcSpec.DNSRecord
+}
+
+// serviceDNSNames returns the names that resolve to the given service
+func serviceDNSNames(aliases map[string]string, svcName string) []string {
+	var names []string
+	for alias, target := range aliases {
+		if target == svcName {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reconcileDNSConfig ensures the ConfigMap holding the resolver Corefile
+// exists when the sandbox publishes any DNS names
+func (r *InspectSandboxReconciler) reconcileDNSConfig(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) error {
+	if !sandboxUsesDNSResolver(sandbox) {
+		return nil
+	}
+
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling DNS config", "sandbox", sandbox.Name)
+
+	aliases, err := sandboxDNSAliases(sandbox)
+	if err != nil {
+		return err
+	}
+
+	upstream, err := r.upstreamDNS(ctx)
+	if err != nil {
+		return err
+	}
+
+	configMap := buildDNSConfigMap(sandbox, aliases, r.clusterDomain(), upstream)
+
+	// The resolver reloads the Corefile when it changes
+	return r.applyObject(ctx, sandbox, &configMap)
+}
+
+// upstreamDNS returns the address the resolver forwards queries to
+func (r *InspectSandboxReconciler) upstreamDNS(ctx context.Context) (string, error) {
+	if r.ClusterDNS != "" {
+		return r.ClusterDNS, nil
+	}
+
+	var kubeDNS corev1.Service
+	if err := r.Get(ctx, types.NamespacedName{Name: "kube-dns", Namespace: "kube-system"}, &kubeDNS); err != nil {
+		return "", fmt.Errorf("looking up cluster DNS service: %w", err)
+	}
+	if kubeDNS.Spec.ClusterIP == "" || kubeDNS.Spec.ClusterIP == corev1.ClusterIPNone {
+		return "", fmt.Errorf("cluster DNS service kube-system/kube-dns has no cluster IP")
+	}
+	return kubeDNS.Spec.ClusterIP, nil
+}
+
+// clusterDomain returns the configured cluster domain or the default
+func (r *InspectSandboxReconciler) clusterDomain() string {
+	if r.ClusterDomain != "" {
+		return r.ClusterDomain
+	}
+	return defaultClusterDomain
+}
+
+// buildDNSConfigMap constructs the ConfigMap holding the resolver Corefile.
+// Each name is rewritten to the headless Service of the service it points
+// at, and everything else is forwarded to the cluster DNS.
+func buildDNSConfigMap(
+	sandbox *inspectv1alpha1.InspectSandbox,
+	aliases map[string]string,
+	clusterDomain string,
+	upstream string,
+) corev1.ConfigMap {
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	var corefile strings.Builder
+	corefile.WriteString(".:53 {\n")
+	corefile.WriteString("    errors\n")
+	corefile.WriteString("    reload\n")
+	for _, alias := range names {
+		target := fmt.Sprintf("%s-%s.%s.svc.%s", sandbox.Name, aliases[alias], sandbox.Namespace, clusterDomain)
+		fmt.Fprintf(&corefile, "    rewrite stop name exact %s %s answer auto\n", alias, target)
+	}
+	fmt.Fprintf(&corefile, "    forward . %s\n", upstream)
+	corefile.WriteString("}\n")
+
+	return corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-dns", sandbox.Name),
+			Namespace: sandbox.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "inspectsandbox",
+				"app.kubernetes.io/instance":   sandbox.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+			},
+		},
+		Data: map[string]string{
+			"Corefile": corefile.String(),
+		},
+	}
+}
+
+// addDNSResolver points the pod's DNS at a CoreDNS sidecar serving the
+// sandbox's names. No search domains are set so bare service names are
+// looked up as-is and can't collide with other Services in the namespace.
+func addDNSResolver(sandbox *inspectv1alpha1.InspectSandbox, podSpec *corev1.PodSpec) {
+	podSpec.DNSPolicy = corev1.DNSNone
+	podSpec.DNSConfig = &corev1.PodDNSConfig{
+		Nameservers: []string{"127.0.0.1"},
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: dnsConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: fmt.Sprintf("%s-dns", sandbox.Name),
+				},
+			},
+		},
+	})
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  dnsResolverContainerName,
+		Image: dnsResolverImage,
+		Args:  []string{"-conf", dnsConfigMountPath + "/Corefile"},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      dnsConfigVolumeName,
+				MountPath: dnsConfigMountPath,
+				ReadOnly:  true,
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add:  []corev1.Capability{"NET_BIND_SERVICE"},
+				Drop: []corev1.Capability{"ALL"},
+			},
+			ReadOnlyRootFilesystem: pointer(true),
+		},
+	})
+}
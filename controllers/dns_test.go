@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newDNSSandbox returns a sandbox called task in the evals namespace with
+// the given services
+func newDNSSandbox(services map[string]inspectv1alpha1.ServiceSpec) *inspectv1alpha1.InspectSandbox {
+	return &inspectv1alpha1.InspectSandbox{
+		ObjectMeta: metav1.ObjectMeta{Name: "task", Namespace: "evals"},
+		Spec:       inspectv1alpha1.InspectSandboxSpec{Services: services},
+	}
+}
+
+func TestSandboxDNSAliases(t *testing.T) {
+	tests := []struct {
+		name         string
+		services     map[string]inspectv1alpha1.ServiceSpec
+		want         map[string]string
+		wantResolver bool
+		wantErr      string
+	}{
+		{
+			name:     "every service opted out",
+			services: map[string]inspectv1alpha1.ServiceSpec{"default": {Image: "ubuntu", DNSRecord: ptrBool(false)}},
+			want:     map[string]string{},
+		},
+		{
+			name: "aliases",
+			services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu", DNSRecord: ptrBool(false)},
+				"web":     {Image: "nginx", DNSRecord: ptrBool(false), AdditionalDNSRecords: []string{"example.com.", "www.example.com"}},
+			},
+			want:         map[string]string{"example.com": "web", "www.example.com": "web"},
+			wantResolver: true,
+		},
+		{
+			name: "service names resolve unless opted out",
+			services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu"},
+				"db":      {Image: "postgres", DNSRecord: ptrBool(true)},
+				"web":     {Image: "nginx", AdditionalDNSRecords: []string{"example.com"}},
+				"sidecar": {Image: "busybox", DNSRecord: ptrBool(false)},
+			},
+			want:         map[string]string{"default": "default", "db": "db", "web": "web", "example.com": "web"},
+			wantResolver: true,
+		},
+		{
+			name: "same alias twice on one service",
+			services: map[string]inspectv1alpha1.ServiceSpec{
+				"web": {Image: "nginx", DNSRecord: ptrBool(false), AdditionalDNSRecords: []string{"example.com", "example.com."}},
+			},
+			want:         map[string]string{"example.com": "web"},
+			wantResolver: true,
+		},
+		{
+			name: "invalid alias",
+			services: map[string]inspectv1alpha1.ServiceSpec{
+				"web": {Image: "nginx", AdditionalDNSRecords: []string{"Not_Valid"}},
+			},
+			wantResolver: true,
+			wantErr:      `invalid DNS record "Not_Valid" for service web`,
+		},
+		{
+			name: "alias claimed twice",
+			services: map[string]inspectv1alpha1.ServiceSpec{
+				"a": {Image: "nginx", AdditionalDNSRecords: []string{"example.com"}},
+				"b": {Image: "nginx", AdditionalDNSRecords: []string{"example.com"}},
+			},
+			wantResolver: true,
+			wantErr:      `DNS record "example.com" is claimed by both`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(tt.services)
+			if got := sandboxUsesDNSResolver(sandbox); got != tt.wantResolver {
+				t.Errorf("sandboxUsesDNSResolver() = %v, want %v", got, tt.wantResolver)
+			}
+
+			got, err := sandboxDNSAliases(sandbox)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aliases = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildDNSConfigMap(t *testing.T) {
+	sandbox := newDNSSandbox(nil)
+	aliases := map[string]string{"www.example.com": "web", "db.internal": "db", "example.com": "web"}
+
+	configMap := buildDNSConfigMap(sandbox, aliases, "cluster.test", "10.96.0.10")
+
+	if configMap.Name != "task-dns" || configMap.Namespace != "evals" {
+		t.Errorf("ConfigMap is %s/%s, want evals/task-dns", configMap.Namespace, configMap.Name)
+	}
+	if got := configMap.Labels["app.kubernetes.io/instance"]; got != "task" {
+		t.Errorf("instance label = %q, want task", got)
+	}
+
+	want := `.:53 {
+    errors
+    reload
+    rewrite stop name exact db.internal task-db.evals.svc.cluster.test answer auto
+    rewrite stop name exact example.com task-web.evals.svc.cluster.test answer auto
+    rewrite stop name exact www.example.com task-web.evals.svc.cluster.test answer auto
+    forward . 10.96.0.10
+}
+`
+	if got := configMap.Data["Corefile"]; got != want {
+		t.Errorf("Corefile =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUpstreamDNS(t *testing.T) {
+	kubeDNS := func(clusterIP string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-dns", Namespace: "kube-system"},
+			Spec:       corev1.ServiceSpec{ClusterIP: clusterIP},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		clusterDNS string
+		kubeDNS    *corev1.Service
+		want       string
+		wantErr    string
+	}{
+		{name: "configured", clusterDNS: "10.0.0.53", kubeDNS: kubeDNS("10.96.0.10"), want: "10.0.0.53"},
+		{name: "looked up", kubeDNS: kubeDNS("10.96.0.10"), want: "10.96.0.10"},
+		{name: "headless", kubeDNS: kubeDNS(corev1.ClusterIPNone), wantErr: "has no cluster IP"},
+		{name: "missing", wantErr: "looking up cluster DNS service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient()
+			if tt.kubeDNS != nil {
+				c = newFakeClient(tt.kubeDNS)
+			}
+			r := &InspectSandboxReconciler{Client: c, Scheme: testScheme, ClusterDNS: tt.clusterDNS}
+
+			got, err := r.upstreamDNS(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("upstreamDNS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// recordDrift reports that obj had to be recreated or changed back, and
+// returns whether it counted as drift. Changes made while the sandbox spec
+// is unchanged since the last reconcile weren't asked for, so something
+// outside the operator deleted or modified obj, unless a template change
+// was just rolled out or the services were just stopped at the deadline.
+func (r *InspectSandboxReconciler) recordDrift(
+	sandbox *inspectv1alpha1.InspectSandbox,
+	obj client.Object,
+	change string,
+) bool {
+	if sandbox.Generation == 0 || sandbox.Status.ObservedGeneration != sandbox.Generation {
+		return false
+	}
+	if condition := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionTemplateResolved); condition != nil &&
+		condition.Reason == templateReasonRolledOut {
+		return false
+	}
+	if condition := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionDeadlineExceeded); condition != nil &&
+		condition.Reason == deadlineReasonStopping {
+		return false
+	}
+
+	sandbox.Status.DriftCorrected++
+	r.Recorder.Eventf(sandbox, corev1.EventTypeWarning, eventReasonDriftCorrected,
+		"%s %s was %s outside the operator and has been restored", r.objectKind(obj), obj.GetName(), change)
+	return true
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+func TestRecordDrift(t *testing.T) {
+	tests := []struct {
+		name               string
+		generation         int64
+		observedGeneration int64
+		wantDrift          int64
+		wantEvent          string
+	}{
+		{name: "never reconciled", generation: 0},
+		{name: "spec changed", generation: 2, observedGeneration: 1},
+		{
+			name:               "spec unchanged",
+			generation:         2,
+			observedGeneration: 2,
+			wantDrift:          1,
+			wantEvent:          "Warning DriftCorrected StatefulSet task-default was deleted outside the operator and has been restored",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(nil)
+			sandbox.Generation = tt.generation
+			sandbox.Status.ObservedGeneration = tt.observedGeneration
+			recorder := record.NewFakeRecorder(10)
+			r := &InspectSandboxReconciler{Client: newFakeClient(), Scheme: testScheme, Recorder: recorder}
+
+			r.recordDrift(sandbox, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "task-default"}}, "deleted")
+
+			if sandbox.Status.DriftCorrected != tt.wantDrift {
+				t.Errorf("driftCorrected = %d, want %d", sandbox.Status.DriftCorrected, tt.wantDrift)
+			}
+			select {
+			case event := <-recorder.Events:
+				if event != tt.wantEvent {
+					t.Errorf("event = %q, want %q", event, tt.wantEvent)
+				}
+			default:
+				if tt.wantEvent != "" {
+					t.Errorf("no event, want %q", tt.wantEvent)
+				}
+			}
+		})
+	}
+}
+
+// TestActiveDeadlineNotDrift checks that stopping the services at the
+// active deadline isn't reported as drift, though the spec hasn't changed
+func TestActiveDeadlineNotDrift(t *testing.T) {
+	sandbox := newDNSSandbox(map[string]inspectv1alpha1.ServiceSpec{"default": {Image: "ubuntu"}})
+	sandbox.UID = "task-uid"
+	sandbox.Generation = 1
+	sandbox.CreationTimestamp = metav1.NewTime(time.Now().Truncate(time.Second))
+	sandbox.Spec.ActiveDeadlineSeconds = ptrInt64(600)
+	c := interceptor.NewClient(newFakeClient(sandbox), emulateApply())
+	r := &InspectSandboxReconciler{
+		Client:               c,
+		Scheme:               testScheme,
+		ClusterDNS:           "10.96.0.10",
+		NetworkPolicyBackend: NetworkPolicyBackendKubernetes,
+		Recorder:             record.NewFakeRecorder(100),
+	}
+	key := client.ObjectKeyFromObject(sandbox)
+
+	reconcile := func() *inspectv1alpha1.InspectSandbox {
+		t.Helper()
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var got inspectv1alpha1.InspectSandbox
+		if err := c.Get(context.Background(), key, &got); err != nil {
+			t.Fatal(err)
+		}
+		return &got
+	}
+	replicas := func() int32 {
+		t.Helper()
+		var sts appsv1.StatefulSet
+		if err := c.Get(context.Background(), client.ObjectKey{Name: "task-default", Namespace: "evals"}, &sts); err != nil {
+			t.Fatal(err)
+		}
+		return *sts.Spec.Replicas
+	}
+
+	reconcile()
+	got := reconcile()
+	if replicas() != 1 || deadlineExceeded(got) {
+		t.Fatalf("services stopped before the deadline")
+	}
+
+	// Cross the deadline
+	got.CreationTimestamp = metav1.NewTime(got.CreationTimestamp.Add(-time.Hour))
+	if err := c.Update(context.Background(), got); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got = reconcile()
+		if replicas() != 0 || !deadlineExceeded(got) {
+			t.Fatalf("reconcile %d: services not stopped past the deadline", i)
+		}
+		if got.Status.DriftCorrected != 0 {
+			t.Errorf("reconcile %d: driftCorrected = %d, want 0", i, got.Status.DriftCorrected)
+		}
+	}
+}
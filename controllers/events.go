@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Reasons for events recorded on InspectSandboxes
+const (
+	// eventReasonCreated is recorded when a child object is created
+	eventReasonCreated = "Created"
+
+	// eventReasonUpdated is recorded when a child object is changed to
+	// match a new sandbox spec
+	eventReasonUpdated = "Updated"
+
+	// eventReasonDeleted is recorded when a child object is deleted
+	eventReasonDeleted = "Deleted"
+
+	// eventReasonRetained is recorded when a volume claim is orphaned
+	// rather than deleted
+	eventReasonRetained = "Retained"
+
+	// eventReasonDriftCorrected is recorded when a child object changed
+	// by something else is restored
+	eventReasonDriftCorrected = "DriftCorrected"
+
+	// eventReasonPoliciesApplied is recorded when network policies start
+	// being enforced
+	eventReasonPoliciesApplied = "NetworkPoliciesApplied"
+
+	// eventReasonPoliciesFailed is recorded when network policies can't be
+	// applied
+	eventReasonPoliciesFailed = "NetworkPoliciesFailed"
+
+	// eventReasonServiceReady is recorded when a service becomes ready
+	eventReasonServiceReady = "ServiceReady"
+
+	// eventReasonServiceNotReady is recorded when a ready service stops
+	// being ready
+	eventReasonServiceNotReady = "ServiceNotReady"
+
+	// eventReasonServiceFailed is recorded when a service can't be reconciled
+	eventReasonServiceFailed = "ServiceReconcileFailed"
+
+	// eventReasonReady is recorded when the whole sandbox becomes ready
+	eventReasonReady = "Ready"
+
+	// eventReasonFailed is recorded when the sandbox is marked Failed
+	eventReasonFailed = "Failed"
+
+	// eventReasonExpired is recorded when a sandbox is deleted for
+	// outliving a TTL
+	eventReasonExpired = "Expired"
+
+	// eventReasonDeadlineExceeded is recorded when a sandbox's services
+	// are stopped for running past its active deadline
+	eventReasonDeadlineExceeded = "DeadlineExceeded"
+
+	// eventReasonSuspended is recorded when a sandbox is suspended
+	eventReasonSuspended = "Suspended"
+
+	// eventReasonResumed is recorded when a suspended sandbox is resumed
+	eventReasonResumed = "Resumed"
+
+	// eventReasonTemplateRolledOut is recorded when a sandbox is rebuilt
+	// from a changed template
+	eventReasonTemplateRolledOut = "TemplateRolledOut"
+
+	// eventReasonTemplateNotResolved is recorded when a sandbox can't be
+	// built from its template
+	eventReasonTemplateNotResolved = "TemplateNotResolved"
+
+	// eventReasonBound is recorded when a claim is bound to a pooled sandbox
+	eventReasonBound = "Bound"
+
+	// eventReasonLost is recorded when a claim's sandbox is deleted
+	eventReasonLost = "Lost"
+
+	// eventReasonFinalizing is recorded as teardown progresses
+	eventReasonFinalizing = "Finalizing"
+
+	// eventReasonFinalized is recorded once every child object is gone
+	eventReasonFinalized = "Finalized"
+)
+
+// objectKind returns the kind of obj for event messages
+func (r *InspectSandboxReconciler) objectKind(obj client.Object) string {
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		return gvk.Kind
+	}
+	return fmt.Sprintf("%T", obj)
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// Reasons for the DeadlineExceeded condition. StoppingServices is only set
+// on the reconcile that stops the services, so scaling them down then isn't
+// taken for drift.
+const (
+	deadlineReasonWithin   = "WithinDeadline"
+	deadlineReasonStopping = "StoppingServices"
+	deadlineReasonExceeded = "DeadlineExceeded"
+)
+
+// sandboxExpiry returns when the sandbox's earliest TTL or heartbeat
+// timeout runs out and the reason to record, or a zero time if none apply
+func (r *InspectSandboxReconciler) sandboxExpiry(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (time.Time, string, error) {
+	var expiry time.Time
+	var reason string
+	consider := func(t time.Time, why string) {
+		if reason == "" || t.Before(expiry) {
+			expiry = t
+			reason = why
+		}
+	}
+
+	if ttl := sandbox.Spec.TTLSecondsAfterCreation; ttl != nil {
+		consider(sandbox.CreationTimestamp.Add(time.Duration(*ttl)*time.Second), "TTLAfterCreationExpired")
+	}
+	if ttl := sandbox.Spec.TTLSecondsAfterReady; ttl != nil && sandbox.Status.FirstReadyTime != nil {
+		consider(sandbox.Status.FirstReadyTime.Add(time.Duration(*ttl)*time.Second), "TTLAfterReadyExpired")
+	}
+	// Parked and unclaimed sandboxes aren't expected to hear from a client
+	if heartbeat := sandbox.Spec.Heartbeat; heartbeat != nil && !sandbox.Spec.Suspend && !isIdlePoolSandbox(sandbox) {
+		last, err := r.lastHeartbeat(ctx, sandbox)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		sandbox.Status.LastHeartbeatTime = &metav1.Time{Time: last}
+		consider(last.Add(time.Duration(heartbeat.TimeoutSeconds)*time.Second), "HeartbeatTimedOut")
+	} else {
+		sandbox.Status.LastHeartbeatTime = nil
+	}
+
+	return expiry, reason, nil
+}
+
+// lastHeartbeat returns the time of the creator's latest heartbeat, or the
+// time the sandbox was created, claimed or last resumed if that is later
+func (r *InspectSandboxReconciler) lastHeartbeat(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (time.Time, error) {
+	last := sandbox.CreationTimestamp.Time
+	if claimedAt, err := time.Parse(time.RFC3339, sandbox.Annotations[inspectv1alpha1.ClaimedAtAnnotation]); err == nil &&
+		claimedAt.After(last) {
+		last = claimedAt
+	}
+	if suspended := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionSuspended); suspended != nil &&
+		suspended.LastTransitionTime.After(last) {
+		last = suspended.LastTransitionTime.Time
+	}
+
+	leaseName := sandbox.Spec.Heartbeat.LeaseName
+	if leaseName == "" {
+		value, ok := sandbox.Annotations[inspectv1alpha1.HeartbeatAnnotation]
+		if !ok {
+			return last, nil
+		}
+		heartbeat, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			// A malformed heartbeat doesn't count, so a broken client
+			// still gets cleaned up
+			log.FromContext(ctx).Info("Ignoring malformed heartbeat annotation", "value", value)
+			return last, nil
+		}
+		if heartbeat.After(last) {
+			last = heartbeat
+		}
+		return last, nil
+	}
+
+	// Read Leases directly rather than caching every Lease in the cluster
+	var lease coordinationv1.Lease
+	err := r.APIReader.Get(ctx, types.NamespacedName{Name: leaseName, Namespace: sandbox.Namespace}, &lease)
+	if errors.IsNotFound(err) {
+		return last, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading heartbeat lease %s: %w", leaseName, err)
+	}
+	if lease.Spec.RenewTime != nil && lease.Spec.RenewTime.After(last) {
+		last = lease.Spec.RenewTime.Time
+	} else if lease.Spec.AcquireTime != nil && lease.Spec.AcquireTime.After(last) {
+		last = lease.Spec.AcquireTime.Time
+	}
+	return last, nil
+}
+
+// expireSandbox deletes the sandbox once a TTL or its heartbeat timeout has
+// run out, recording why first. The finalizer then tears everything down as
+// usual. Returns whether the sandbox was deleted, and otherwise how long
+// until it will be.
+func (r *InspectSandboxReconciler) expireSandbox(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (bool, time.Duration, error) {
+	expiry, reason, err := r.sandboxExpiry(ctx, sandbox)
+	if err != nil || reason == "" {
+		return false, 0, err
+	}
+	if remaining := time.Until(expiry); remaining > 0 {
+		return false, remaining, nil
+	}
+
+	message := fmt.Sprintf("Sandbox expired at %s and is being deleted", expiry.UTC().Format(time.RFC3339))
+	if reason == "HeartbeatTimedOut" {
+		message = fmt.Sprintf("No heartbeat since %s, deleting the sandbox",
+			sandbox.Status.LastHeartbeatTime.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, metav1.Condition{
+		Type:               inspectv1alpha1.ConditionExpired,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	if err := r.Status().Update(ctx, sandbox); err != nil {
+		return false, 0, err
+	}
+	r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonExpired, message)
+
+	if err := r.Delete(ctx, sandbox); err != nil && !errors.IsNotFound(err) {
+		return false, 0, err
+	}
+	return true, 0, nil
+}
+
+// checkActiveDeadline sets the DeadlineExceeded condition when the sandbox
+// has run past its active deadline, which stops its services. Returns how
+// long until the deadline passes, or zero if it has or there is none.
+func (r *InspectSandboxReconciler) checkActiveDeadline(sandbox *inspectv1alpha1.InspectSandbox) time.Duration {
+	if sandbox.Spec.ActiveDeadlineSeconds == nil {
+		meta.RemoveStatusCondition(&sandbox.Status.Conditions, inspectv1alpha1.ConditionDeadlineExceeded)
+		return 0
+	}
+
+	deadline := sandbox.CreationTimestamp.Add(time.Duration(*sandbox.Spec.ActiveDeadlineSeconds) * time.Second)
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionDeadlineExceeded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             deadlineReasonWithin,
+		Message:            fmt.Sprintf("Services may run until %s", deadline.UTC().Format(time.RFC3339)),
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = deadlineReasonExceeded
+		condition.Message = fmt.Sprintf("Sandbox ran past its active deadline of %ds and its services were stopped",
+			*sandbox.Spec.ActiveDeadlineSeconds)
+		remaining = 0
+		if !deadlineExceeded(sandbox) {
+			condition.Reason = deadlineReasonStopping
+			r.Recorder.Event(sandbox, corev1.EventTypeWarning, eventReasonDeadlineExceeded, condition.Message)
+		}
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, condition)
+	return remaining
+}
+
+// deadlineExceeded reports whether the sandbox's services have been
+// stopped for running past its active deadline
+func deadlineExceeded(sandbox *inspectv1alpha1.InspectSandbox) bool {
+	return meta.IsStatusConditionTrue(sandbox.Status.Conditions, inspectv1alpha1.ConditionDeadlineExceeded)
+}
+
+// shortestRequeue returns the shortest non-zero duration, or zero if none are
+func shortestRequeue(durations ...time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, d := range durations {
+		if d > 0 && (shortest == 0 || d < shortest) {
+			shortest = d
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// sandboxFinalizer holds deletion of an InspectSandbox until its child
+// objects have been torn down in order
+const sandboxFinalizer = "inspect.example.com/finalizer"
+
+// finalizeRequeueInterval is how often teardown progress is checked
+const finalizeRequeueInterval = 2 * time.Second
+
+// finalizeSandbox tears down the sandbox's child objects. Workloads go
+// first and network policies last, so pods are never left running without
+// their isolation. Returns true once teardown is complete.
+func (r *InspectSandboxReconciler) finalizeSandbox(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (bool, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Finalizing InspectSandbox", "sandbox", sandbox.Name)
+
+	// Delete StatefulSets so their pods start terminating
+	var statefulSets appsv1.StatefulSetList
+	if err := r.List(ctx, &statefulSets, sandboxListOptions(sandbox)...); err != nil {
+		return false, err
+	}
+	for i := range statefulSets.Items {
+		if err := r.deleteOwned(ctx, sandbox, &statefulSets.Items[i]); err != nil {
+			return false, err
+		}
+	}
+
+	// Wait for every pod to be gone before lifting any restrictions
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, sandboxListOptions(sandbox)...); err != nil {
+		return false, err
+	}
+	if len(pods.Items) > 0 {
+		return false, r.setTerminatingCondition(ctx, sandbox, "WaitingForPods",
+			fmt.Sprintf("Waiting for %d pod(s) to terminate", len(pods.Items)))
+	}
+
+	// Delete Services now nothing is left behind them
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services, sandboxListOptions(sandbox)...); err != nil {
+		return false, err
+	}
+	for i := range services.Items {
+		if err := r.deleteOwned(ctx, sandbox, &services.Items[i]); err != nil {
+			return false, err
+		}
+	}
+
+	// Delete or orphan volume claims according to the retention policy
+	var claims corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &claims, sandboxListOptions(sandbox)...); err != nil {
+		return false, err
+	}
+	for i := range claims.Items {
+		if err := r.releaseVolumeClaim(ctx, sandbox, &claims.Items[i]); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.setTerminatingCondition(ctx, sandbox, "RemovingNetworkPolicies",
+		"All pods terminated, removing network policies"); err != nil {
+		return false, err
+	}
+
+	// Network policies go last
+	var policies ciliumv2.CiliumNetworkPolicyList
+	if err := r.List(ctx, &policies, sandboxListOptions(sandbox)...); err != nil {
+		// Nothing to clean up if Cilium isn't installed
+		if !meta.IsNoMatchError(err) {
+			return false, err
+		}
+	}
+	for i := range policies.Items {
+		if err := r.deleteOwned(ctx, sandbox, &policies.Items[i]); err != nil {
+			return false, err
+		}
+	}
+
+	var kubePolicies networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &kubePolicies, sandboxListOptions(sandbox)...); err != nil {
+		return false, err
+	}
+	for i := range kubePolicies.Items {
+		if err := r.deleteOwned(ctx, sandbox, &kubePolicies.Items[i]); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// setTerminatingCondition records teardown progress on the sandbox status
+func (r *InspectSandboxReconciler) setTerminatingCondition(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	reason string,
+	message string,
+) error {
+	phaseChanged := sandbox.Status.Phase != inspectv1alpha1.PhaseTerminating
+	sandbox.Status.Phase = inspectv1alpha1.PhaseTerminating
+	conditionChanged := meta.SetStatusCondition(&sandbox.Status.Conditions, metav1.Condition{
+		Type:               inspectv1alpha1.ConditionTerminating,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	if !phaseChanged && !conditionChanged {
+		return nil
+	}
+	r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonFinalizing, message)
+	return r.Status().Update(ctx, sandbox)
+}
+
+// releaseVolumeClaim deletes a volume claim, or orphans it when the
+// sandbox's retention policy says to keep it
+func (r *InspectSandboxReconciler) releaseVolumeClaim(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	pvc *corev1.PersistentVolumeClaim,
+) error {
+	if sandbox.Spec.VolumeRetentionPolicy != inspectv1alpha1.VolumeRetentionRetain {
+		return r.deleteOwned(ctx, sandbox, pvc)
+	}
+	if !metav1.IsControlledBy(pvc, sandbox) {
+		return nil
+	}
+	if err := controllerutil.RemoveControllerReference(sandbox, pvc, r.Scheme); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Retaining volume claim", "name", pvc.Name)
+	if err := r.Update(ctx, pvc); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(sandbox, corev1.EventTypeNormal, eventReasonRetained,
+		"Retained PersistentVolumeClaim %s under the Retain volume retention policy", pvc.Name)
+	return nil
+}
+
+// deleteOwned deletes obj if it is controlled by the sandbox
+func (r *InspectSandboxReconciler) deleteOwned(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	obj client.Object,
+) error {
+	if !metav1.IsControlledBy(obj, sandbox) || !obj.GetDeletionTimestamp().IsZero() {
+		return nil
+	}
+	err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	childObjectOperations.WithLabelValues(r.objectKind(obj), "delete").Inc()
+	r.Recorder.Eventf(sandbox, corev1.EventTypeNormal, eventReasonDeleted,
+		"Deleted %s %s", r.objectKind(obj), obj.GetName())
+	return nil
+}
+
+// sandboxListOptions selects the objects the operator created for a sandbox
+func sandboxListOptions(sandbox *inspectv1alpha1.InspectSandbox) []client.ListOption {
+	return []client.ListOption{
+		client.InNamespace(sandbox.Namespace),
+		client.MatchingLabels{
+			"app.kubernetes.io/instance":   sandbox.Name,
+			"app.kubernetes.io/managed-by": "inspect-operator",
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// Defaults for healthcheck fields that aren't set, which are compose's so
+// imported healthchecks behave as they did under compose
+const (
+	defaultHealthcheckInterval = 30
+	defaultHealthcheckTimeout  = 30
+	defaultHealthcheckRetries  = 3
+)
+
+// addHealthcheckProbes turns a service's healthcheck into probes on its
+// container. The readiness probe keeps the service out of Ready until a
+// check passes, a startup probe stands in for the start period, and a
+// liveness probe is only added if the healthcheck asks for restarts.
+func addHealthcheckProbes(container *corev1.Container, hc *inspectv1alpha1.Healthcheck) {
+	if hc == nil {
+		return
+	}
+
+	interval := int32OrDefault(hc.IntervalSeconds, defaultHealthcheckInterval)
+	probe := &corev1.Probe{
+		ProbeHandler:     healthcheckHandler(hc),
+		PeriodSeconds:    interval,
+		TimeoutSeconds:   int32OrDefault(hc.TimeoutSeconds, defaultHealthcheckTimeout),
+		SuccessThreshold: 1,
+		FailureThreshold: int32OrDefault(hc.Retries, defaultHealthcheckRetries),
+	}
+	container.ReadinessProbe = probe
+
+	if hc.Liveness {
+		container.LivenessProbe = probe.DeepCopy()
+	}
+
+	// Readiness and liveness probes only start once the startup probe
+	// passes, so it tolerates failures for the whole start period plus the
+	// usual retries
+	if startPeriod := int32OrDefault(hc.StartPeriodSeconds, 0); startPeriod > 0 {
+		startup := probe.DeepCopy()
+		startup.FailureThreshold += (startPeriod + interval - 1) / interval
+		container.StartupProbe = startup
+	}
+}
+
+// healthcheckHandler returns the probe handler for whichever check the
+// healthcheck sets, which validation guarantees is exactly one
+func healthcheckHandler(hc *inspectv1alpha1.Healthcheck) corev1.ProbeHandler {
+	switch {
+	case hc.HTTPGet != nil:
+		path := hc.HTTPGet.Path
+		if path == "" {
+			path = "/"
+		}
+		scheme := hc.HTTPGet.Scheme
+		if scheme == "" {
+			scheme = corev1.URISchemeHTTP
+		}
+		return corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   path,
+				Port:   intstr.FromInt32(hc.HTTPGet.Port),
+				Scheme: scheme,
+			},
+		}
+	case hc.TCPSocket != nil:
+		return corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(hc.TCPSocket.Port)},
+		}
+	default:
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: hc.Exec},
+		}
+	}
+}
+
+// int32OrDefault returns *value, or def if value is nil
+func int32OrDefault(value *int32, def int32) int32 {
+	if value == nil {
+		return def
+	}
+	return *value
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+func TestAddHealthcheckProbes(t *testing.T) {
+	exec := corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"pg_isready"}}}
+	probe := func(handler corev1.ProbeHandler, period, timeout, failures int32) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    period,
+			TimeoutSeconds:   timeout,
+			SuccessThreshold: 1,
+			FailureThreshold: failures,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		healthcheck   *inspectv1alpha1.Healthcheck
+		wantReadiness *corev1.Probe
+		wantLiveness  *corev1.Probe
+		wantStartup   *corev1.Probe
+	}{
+		{
+			name: "no healthcheck",
+		},
+		{
+			name:          "compose defaults",
+			healthcheck:   &inspectv1alpha1.Healthcheck{Exec: []string{"pg_isready"}},
+			wantReadiness: probe(exec, 30, 30, 3),
+		},
+		{
+			name: "settings",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				Exec:            []string{"pg_isready"},
+				IntervalSeconds: ptrInt32(2),
+				TimeoutSeconds:  ptrInt32(1),
+				Retries:         ptrInt32(5),
+			},
+			wantReadiness: probe(exec, 2, 1, 5),
+		},
+		{
+			name: "start period rounded up to whole intervals",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				Exec:               []string{"pg_isready"},
+				IntervalSeconds:    ptrInt32(10),
+				StartPeriodSeconds: ptrInt32(25),
+			},
+			wantReadiness: probe(exec, 10, 30, 3),
+			wantStartup:   probe(exec, 10, 30, 6),
+		},
+		{
+			name: "zero start period",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				Exec:               []string{"pg_isready"},
+				StartPeriodSeconds: ptrInt32(0),
+			},
+			wantReadiness: probe(exec, 30, 30, 3),
+		},
+		{
+			name: "liveness",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				Exec:     []string{"pg_isready"},
+				Liveness: true,
+			},
+			wantReadiness: probe(exec, 30, 30, 3),
+			wantLiveness:  probe(exec, 30, 30, 3),
+		},
+		{
+			name: "HTTP check with defaults",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				HTTPGet: &inspectv1alpha1.HTTPGetHealthcheck{Port: 8080},
+			},
+			wantReadiness: probe(corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/",
+				Port:   intstr.FromInt32(8080),
+				Scheme: corev1.URISchemeHTTP,
+			}}, 30, 30, 3),
+		},
+		{
+			name: "TCP check",
+			healthcheck: &inspectv1alpha1.Healthcheck{
+				TCPSocket: &inspectv1alpha1.TCPSocketHealthcheck{Port: 5432},
+			},
+			wantReadiness: probe(corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt32(5432),
+			}}, 30, 30, 3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var container corev1.Container
+			addHealthcheckProbes(&container, tt.healthcheck)
+
+			if !equality.Semantic.DeepEqual(container.ReadinessProbe, tt.wantReadiness) {
+				t.Errorf("readiness probe = %+v, want %+v", container.ReadinessProbe, tt.wantReadiness)
+			}
+			if !equality.Semantic.DeepEqual(container.LivenessProbe, tt.wantLiveness) {
+				t.Errorf("liveness probe = %+v, want %+v", container.LivenessProbe, tt.wantLiveness)
+			}
+			if !equality.Semantic.DeepEqual(container.StartupProbe, tt.wantStartup) {
+				t.Errorf("startup probe = %+v, want %+v", container.StartupProbe, tt.wantStartup)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// testScheme knows every kind the operator reads or writes
+var testScheme = func() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(inspectv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(ciliumv2.AddToScheme(scheme))
+	return scheme
+}()
+
+// newFakeClient returns a client holding objs, with the status subresource
+// enabled for the operator's own kinds
+func newFakeClient(objs ...client.Object) client.WithWatch {
+	return fake.NewClientBuilder().
+		WithScheme(testScheme).
+		WithObjects(objs...).
+		WithStatusSubresource(
+			&inspectv1alpha1.InspectSandbox{},
+			&inspectv1alpha1.InspectSandboxPool{},
+			&inspectv1alpha1.InspectSandboxClaim{},
+			&inspectv1alpha1.InspectSandboxSet{},
+		).
+		Build()
+}
+
+func ptrBool(v bool) *bool {
+	return &v
+}
+
+func ptrInt32(v int32) *int32 {
+	return &v
+}
+
+func ptrInt64(v int64) *int64 {
+	return &v
+}
@@ -3,58 +3,77 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
 	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
 )
 
-// CiliumNetworkPolicy is a simplified representation of the Cilium network policy
-type CiliumNetworkPolicy struct {
-	metav1.TypeMeta   `json:",inline"`
-	metav1.ObjectMeta `json:"metadata,omitempty"`
-	Spec              map[string]interface{} `json:"spec,omitempty"`
-}
-
-// DeepCopyObject implements runtime.Object interface
-func (p *CiliumNetworkPolicy) DeepCopyObject() runtime.Object {
-	c := &CiliumNetworkPolicy{
-		TypeMeta:   p.TypeMeta,
-		ObjectMeta: *p.ObjectMeta.DeepCopy(),
-	}
-
-	if p.Spec != nil {
-		c.Spec = make(map[string]interface{}, len(p.Spec))
-		for k, v := range p.Spec {
-			c.Spec[k] = v
-		}
-	}
-
-	return c
-}
+// defaultVolumeSize is the storage requested for volumes that don't specify a size
+const defaultVolumeSize = "1Gi"
 
 // InspectSandboxReconciler reconciles an InspectSandbox object
 type InspectSandboxReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// ClusterDomain is the cluster's DNS domain, defaults to cluster.local
+	ClusterDomain string
+
+	// ClusterDNS is the address sandbox DNS resolvers forward to. When
+	// empty the kube-system/kube-dns Service is looked up.
+	ClusterDNS string
+
+	// APIReader reads objects the manager doesn't cache, such as events
+	APIReader client.Reader
+
+	// FailureGracePeriod is how long services may fail before the sandbox
+	// is marked Failed, unless the sandbox sets its own
+	FailureGracePeriod time.Duration
+
+	// NetworkPolicyBackend is the API sandboxes are isolated with,
+	// defaults to Cilium
+	NetworkPolicyBackend NetworkPolicyBackend
+
+	// Defaulter fills in the webhook's defaults on sandboxes built from a
+	// template, which the webhook leaves alone
+	Defaulter *inspectv1alpha1.InspectSandboxDefaulter
+
+	// Recorder emits events on sandboxes
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxes/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxes/finalizers,verbs=update
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxtemplates,verbs=get;list;watch
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services;configmaps;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;create;patch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get
 // +kubebuilder:rbac:groups=cilium.io,resources=ciliumnetworkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile handles the reconciliation loop for InspectSandbox resources
 func (r *InspectSandboxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -72,29 +91,128 @@ func (r *InspectSandboxReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
+	// Tear down child objects in order before letting the sandbox go
+	if !sandbox.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&sandbox, sandboxFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		// Tear down according to the template the sandbox was built from
+		sandbox.Spec = templateSpec(&sandbox)
+		done, err := r.finalizeSandbox(ctx, &sandbox)
+		if err != nil {
+			logger.Error(err, "Failed to finalize InspectSandbox")
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: finalizeRequeueInterval}, nil
+		}
+		// Patch rather than update so the merged spec is never written back
+		patch := client.MergeFrom(sandbox.DeepCopy())
+		controllerutil.RemoveFinalizer(&sandbox, sandboxFinalizer)
+		if err := r.Patch(ctx, &sandbox, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Event(&sandbox, corev1.EventTypeNormal, eventReasonFinalized, "All child objects have been removed")
+		return ctrl.Result{}, nil
+	}
+
+	// Register the finalizer before creating anything it needs to clean up
+	if controllerutil.AddFinalizer(&sandbox, sandboxFinalizer) {
+		if err := r.Update(ctx, &sandbox); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Merge in the referenced template. From here on the spec is the
+	// effective one and must not be written back.
+	resolved, err := r.resolveTemplate(ctx, &sandbox)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !resolved {
+		return ctrl.Result{RequeueAfter: templateRetryInterval}, nil
+	}
+
+	// Note suspension first, as resuming restarts the heartbeat timeout
+	r.setSuspendedCondition(&sandbox)
+
+	// Delete the sandbox once it outlives its TTL or its creator goes away
+	expired, expiryRequeue, err := r.expireSandbox(ctx, &sandbox)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if expired {
+		return ctrl.Result{}, nil
+	}
+
+	// Stop services that have run past the active deadline
+	deadlineRequeue := r.checkActiveDeadline(&sandbox)
+
 	// Initialize status if not already
 	if sandbox.Status.Services == nil {
 		sandbox.Status.Services = make(map[string]inspectv1alpha1.ServiceStatus)
 	}
 
+	// Keep going when one part fails so status reflects everything we can
+	// observe, and report the errors together at the end
+	var errs []error
+
 	// Reconcile volumes if defined
 	for volName, volSpec := range sandbox.Spec.Volumes {
 		if err := r.reconcileVolume(ctx, &sandbox, volName, volSpec); err != nil {
-			return ctrl.Result{}, err
+			logger.Error(err, "Failed to reconcile volume", "name", volName)
+			errs = append(errs, err)
 		}
 	}
 
-	// Reconcile services
-	for svcName, svcSpec := range sandbox.Spec.Services {
+	// Reconcile the DNS resolver config before any pods depend on it
+	if err := r.reconcileDNSConfig(ctx, &sandbox); err != nil {
+		logger.Error(err, "Failed to reconcile DNS config")
+		errs = append(errs, err)
+	}
+
+	// Reconcile services after the services they depend on, so their
+	// status is up to date when deciding whether to wait for them
+	svcNames, err := inspectv1alpha1.ServiceStartOrder(sandbox.Spec.Services)
+	if err != nil {
+		// Only possible without the webhook. Services in the cycle wait for
+		// each other, which shows in their status.
+		logger.Error(err, "Invalid service dependencies")
+		svcNames = make([]string, 0, len(sandbox.Spec.Services))
+		for svcName := range sandbox.Spec.Services {
+			svcNames = append(svcNames, svcName)
+		}
+		sort.Strings(svcNames)
+	}
+	for _, svcName := range svcNames {
+		svcSpec := sandbox.Spec.Services[svcName]
 		if err := r.reconcileService(ctx, &sandbox, svcName, svcSpec); err != nil {
-			return ctrl.Result{}, err
+			logger.Error(err, "Failed to reconcile service", "name", svcName)
+			r.Recorder.Eventf(&sandbox, corev1.EventTypeWarning, eventReasonServiceFailed,
+				"Failed to reconcile service %s: %v", svcName, err)
+			errs = append(errs, err)
 		}
 	}
 
 	// Reconcile network policies
-	if err := r.reconcileNetworkPolicies(ctx, &sandbox); err != nil {
-		logger.Error(err, "Failed to reconcile network policies")
-		return ctrl.Result{}, err
+	policyErr := r.reconcileNetworkPolicies(ctx, &sandbox)
+	if policyErr != nil {
+		logger.Error(policyErr, "Failed to reconcile network policies")
+		networkPolicyFailures.WithLabelValues(sandbox.Namespace, string(r.networkPolicyBackend())).Inc()
+		errs = append(errs, policyErr)
+	}
+
+	// Remove anything left over from services, volumes or networks that
+	// have been dropped from the spec
+	if err := r.pruneResources(ctx, &sandbox); err != nil {
+		logger.Error(err, "Failed to prune InspectSandbox resources")
+		errs = append(errs, err)
+	}
+
+	// Summarise the outcome in conditions and phase
+	requeueAfter, err := r.updateStatusConditions(ctx, &sandbox, policyErr)
+	if err != nil {
+		errs = append(errs, err)
 	}
 
 	// Update status
@@ -103,7 +221,10 @@ func (r *InspectSandboxReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Come back when a failing service runs out of grace, or the sandbox
+	// reaches its deadline or expires
+	requeueAfter = shortestRequeue(requeueAfter, expiryRequeue, deadlineRequeue)
+	return ctrl.Result{RequeueAfter: requeueAfter}, kerrors.NewAggregate(errs)
 }
 
 // reconcileVolume ensures a PVC exists for the specified volume
@@ -116,10 +237,36 @@ func (r *InspectSandboxReconciler) reconcileVolume(
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling volume", "name", volName)
 
-	// Implement PVC creation logic here
-	// This is a placeholder for actual implementation
+	pvcName := types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%s", sandbox.Name, volName),
+		Namespace: sandbox.Namespace,
+	}
 
-	return nil
+	desired, err := buildPersistentVolumeClaim(sandbox, volName, volSpec)
+	if err != nil {
+		return err
+	}
+
+	// Check if PVC already exists
+	var pvc corev1.PersistentVolumeClaim
+	err = r.Get(ctx, pvcName, &pvc)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	// Everything but the storage request is immutable once the claim exists,
+	// and the request can only grow, so keep what the claim already has
+	if err == nil {
+		desired.Spec.AccessModes = pvc.Spec.AccessModes
+		desired.Spec.StorageClassName = pvc.Spec.StorageClassName
+		desired.Spec.VolumeMode = pvc.Spec.VolumeMode
+		requested := desired.Spec.Resources.Requests[corev1.ResourceStorage]
+		if current, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok && requested.Cmp(current) < 0 {
+			desired.Spec.Resources.Requests[corev1.ResourceStorage] = current
+		}
+	}
+
+	return r.applyObject(ctx, sandbox, &desired)
 }
 
 // reconcileService ensures a StatefulSet and Service exist for the specified service
@@ -132,6 +279,21 @@ func (r *InspectSandboxReconciler) reconcileService(
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling service", "name", svcName)
 
+	// Reject volume mounts that can't be satisfied before touching the StatefulSet
+	if err := validateServiceVolumes(sandbox, svcSpec); err != nil {
+		sandbox.Status.Services[svcName] = inspectv1alpha1.ServiceStatus{
+			Ready:   false,
+			Message: fmt.Sprintf("Invalid volumes: %v", err),
+		}
+		return err
+	}
+
+	// Hold back services whose dependencies aren't up yet
+	waiting, err := r.waitForDependencies(ctx, sandbox, svcName, svcSpec)
+	if err != nil || waiting {
+		return err
+	}
+
 	// Create or update the StatefulSet
 	sts, err := r.reconcileStatefulSet(ctx, sandbox, svcName, svcSpec)
 	if err != nil {
@@ -142,25 +304,32 @@ func (r *InspectSandboxReconciler) reconcileService(
 		return err
 	}
 
-	// Create or update the Service if DNS is enabled
-	if svcSpec.DNSRecord || len(svcSpec.AdditionalDNSRecords) > 0 {
-		if err := r.reconcileKubeService(ctx, sandbox, svcName, svcSpec); err != nil {
-			sandbox.Status.Services[svcName] = inspectv1alpha1.ServiceStatus{
-				Ready:   false,
-				Message: fmt.Sprintf("Failed to reconcile Service: %v", err),
-			}
-			return err
+	// Create or update the governing Service, which every StatefulSet needs
+	// for its pods to get DNS records
+	if err := r.reconcileKubeService(ctx, sandbox, svcName, svcSpec); err != nil {
+		sandbox.Status.Services[svcName] = inspectv1alpha1.ServiceStatus{
+			Ready:   false,
+			Message: fmt.Sprintf("Failed to reconcile Service: %v", err),
 		}
+		return err
 	}
 
 	// Update service status
-	ready := sts.Status.ReadyReplicas > 0
-	sandbox.Status.Services[svcName] = inspectv1alpha1.ServiceStatus{
-		Ready:   ready,
-		Message: getStatusMessage(sts),
+	previous := sandbox.Status.Services[svcName]
+	status, err := r.buildServiceStatus(ctx, sandbox, svcName, sts)
+	sandbox.Status.Services[svcName] = status
+	switch {
+	case status.Ready && !previous.Ready:
+		r.Recorder.Eventf(sandbox, corev1.EventTypeNormal, eventReasonServiceReady,
+			"Service %s is ready", svcName)
+		if sandbox.Status.FirstReadyTime == nil {
+			serviceTimeToReady.WithLabelValues(sandbox.Namespace, svcName).Observe(sinceCreation(sandbox))
+		}
+	case !status.Ready && previous.Ready:
+		r.Recorder.Eventf(sandbox, corev1.EventTypeWarning, eventReasonServiceNotReady,
+			"Service %s is no longer ready: %s", svcName, status.Message)
 	}
-
-	return nil
+	return err
 }
 
 // reconcileStatefulSet ensures a StatefulSet exists for the service
@@ -170,41 +339,12 @@ func (r *InspectSandboxReconciler) reconcileStatefulSet(
 	svcName string,
 	svcSpec inspectv1alpha1.ServiceSpec,
 ) (*appsv1.StatefulSet, error) {
-	stsName := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-%s", sandbox.Name, svcName),
-		Namespace: sandbox.Namespace,
-	}
-
-	// Check if StatefulSet already exists
-	var sts appsv1.StatefulSet
-	err := r.Get(ctx, stsName, &sts)
-	if err != nil && !errors.IsNotFound(err) {
-		return nil, err
-	}
-
-	// Create new StatefulSet if it doesn't exist
-	if errors.IsNotFound(err) {
-		sts = buildStatefulSet(sandbox, svcName, svcSpec)
-		if err := controllerutil.SetControllerReference(sandbox, &sts, r.Scheme); err != nil {
-			return nil, err
-		}
-		if err := r.Create(ctx, &sts); err != nil {
-			return nil, err
-		}
-	} else {
-		// Update existing StatefulSet if needed
-		newSts := buildStatefulSet(sandbox, svcName, svcSpec)
-		sts.Spec = newSts.Spec
-		if err := r.Update(ctx, &sts); err != nil {
-			return nil, err
-		}
-	}
-
-	// Fetch updated StatefulSet with status
-	if err := r.Get(ctx, stsName, &sts); err != nil {
+	sts := buildStatefulSet(sandbox, svcName, svcSpec)
+	if err := r.applyObject(ctx, sandbox, &sts); err != nil {
 		return nil, err
 	}
 
+	// The apply response includes the StatefulSet's status
 	return &sts, nil
 }
 
@@ -215,38 +355,8 @@ func (r *InspectSandboxReconciler) reconcileKubeService(
 	svcName string,
 	svcSpec inspectv1alpha1.ServiceSpec,
 ) error {
-	serviceName := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-%s", sandbox.Name, svcName),
-		Namespace: sandbox.Namespace,
-	}
-
-	// Check if Service already exists
-	var service corev1.Service
-	err := r.Get(ctx, serviceName, &service)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
-	}
-
-	// Create new Service if it doesn't exist
-	if errors.IsNotFound(err) {
-		service = buildKubeService(sandbox, svcName, svcSpec)
-		if err := controllerutil.SetControllerReference(sandbox, &service, r.Scheme); err != nil {
-			return err
-		}
-		if err := r.Create(ctx, &service); err != nil {
-			return err
-		}
-	} else {
-		// Update existing Service if needed
-		newService := buildKubeService(sandbox, svcName, svcSpec)
-		service.Spec.Ports = newService.Spec.Ports
-		service.Spec.Selector = newService.Spec.Selector
-		if err := r.Update(ctx, &service); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	service := buildKubeService(sandbox, svcName, svcSpec)
+	return r.applyObject(ctx, sandbox, &service)
 }
 
 // buildStatefulSet constructs a StatefulSet for the service
@@ -265,6 +375,34 @@ func buildStatefulSet(sandbox *inspectv1alpha1.InspectSandbox, svcName string, s
 		labels[fmt.Sprintf("inspect.example.com/network-%s", network)] = "true"
 	}
 
+	// Mount the sandbox volumes referenced by the service. Invalid entries
+	// are rejected by validateServiceVolumes before we get here.
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	mountedVolumes := make(map[string]bool)
+	for _, entry := range svcSpec.Volumes {
+		mount, err := inspectv1alpha1.ParseVolumeMount(entry)
+		if err != nil {
+			continue
+		}
+		if _, ok := sandbox.Spec.Volumes[mount.Name]; !ok {
+			continue
+		}
+		volumeMounts = append(volumeMounts, mount)
+		if mountedVolumes[mount.Name] {
+			continue
+		}
+		mountedVolumes[mount.Name] = true
+		volumes = append(volumes, corev1.Volume{
+			Name: mount.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: fmt.Sprintf("%s-%s", sandbox.Name, mount.Name),
+				},
+			},
+		})
+	}
+
 	// Create pod template
 	podTemplate := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
@@ -274,18 +412,29 @@ func buildStatefulSet(sandbox *inspectv1alpha1.InspectSandbox, svcName string, s
 			EnableServiceLinks: pointer(false),
 			Containers: []corev1.Container{
 				{
-					Name:       svcName,
-					Image:      svcSpec.Image,
-					Command:    svcSpec.Command,
-					Args:       svcSpec.Args,
-					WorkingDir: svcSpec.WorkingDir,
-					Env:        append([]corev1.EnvVar{{Name: "AGENT_ENV", Value: sandbox.Name}}, svcSpec.Env...),
-					Resources:  svcSpec.Resources,
+					Name:         svcName,
+					Image:        svcSpec.Image,
+					Command:      svcSpec.Command,
+					Args:         svcSpec.Args,
+					WorkingDir:   svcSpec.WorkingDir,
+					Env:          append([]corev1.EnvVar{{Name: "AGENT_ENV", Value: sandbox.Name}}, svcSpec.Env...),
+					Resources:    svcSpec.Resources,
+					Ports:        buildContainerPorts(svcSpec),
+					VolumeMounts: volumeMounts,
 				},
 			},
+			Volumes: volumes,
 		},
 	}
 
+	// Only count the service as ready once its healthcheck passes
+	addHealthcheckProbes(&podTemplate.Spec.Containers[0], svcSpec.Healthcheck)
+
+	// Resolve service names and aliases through a sidecar if there are any
+	if sandboxUsesDNSResolver(sandbox) {
+		addDNSResolver(sandbox, &podTemplate.Spec)
+	}
+
 	// Set runtime class if specified
 	if svcSpec.RuntimeClassName != "" && svcSpec.RuntimeClassName != "CLUSTER_DEFAULT" {
 		podTemplate.Spec.RuntimeClassName = pointer(svcSpec.RuntimeClassName)
@@ -293,14 +442,20 @@ func buildStatefulSet(sandbox *inspectv1alpha1.InspectSandbox, svcName string, s
 
 	// Create statefulset
 	return appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "StatefulSet",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: sandbox.Namespace,
 			Labels:    labels,
 		},
 		Spec: appsv1.StatefulSetSpec{
-			ServiceName: fmt.Sprintf("%s-service", svcName),
-			Replicas:    pointer(int32(1)),
+			// The StatefulSet controller sets each pod's hostname and subdomain
+			// from this, so it must match the Service built by buildKubeService
+			ServiceName: name,
+			Replicas:    pointer(serviceReplicas(sandbox)),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					"app.kubernetes.io/instance":  sandbox.Name,
@@ -313,10 +468,23 @@ func buildStatefulSet(sandbox *inspectv1alpha1.InspectSandbox, svcName string, s
 	}
 }
 
+// serviceReplicas returns how many pods each service should run, which is
+// none while the sandbox is suspended or once it is past its active deadline
+func serviceReplicas(sandbox *inspectv1alpha1.InspectSandbox) int32 {
+	if sandbox.Spec.Suspend || deadlineExceeded(sandbox) {
+		return 0
+	}
+	return 1
+}
+
 // buildKubeService constructs a Kubernetes Service for the service
 func buildKubeService(sandbox *inspectv1alpha1.InspectSandbox, svcName string, svcSpec inspectv1alpha1.ServiceSpec) corev1.Service {
 	name := fmt.Sprintf("%s-%s", sandbox.Name, svcName)
 	return corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: sandbox.Namespace,
@@ -329,193 +497,190 @@ func buildKubeService(sandbox *inspectv1alpha1.InspectSandbox, svcName string, s
 		},
 		Spec: corev1.ServiceSpec{
 			ClusterIP: "None", // Headless service
+			// Publish addresses as soon as pods exist, like compose does,
+			// rather than waiting for them to become ready
+			PublishNotReadyAddresses: true,
 			Selector: map[string]string{
 				"app.kubernetes.io/instance":  sandbox.Name,
 				"app.kubernetes.io/component": svcName,
 				"inspect/service":             svcName,
 			},
+			Ports: buildServicePorts(svcSpec),
 		},
 	}
 }
 
-// getStatusMessage returns a status message for the service
-func getStatusMessage(sts *appsv1.StatefulSet) string {
-	if sts.Status.ReadyReplicas > 0 {
-		return "Service is ready"
-	}
-	if sts.Status.Replicas == 0 {
-		return "Service is starting"
-	}
-	return "Service is not ready"
+// buildContainerPorts constructs the container ports for the service
+func buildContainerPorts(svcSpec inspectv1alpha1.ServiceSpec) []corev1.ContainerPort {
+	var ports []corev1.ContainerPort
+	for _, port := range svcSpec.Ports {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          portName(port),
+			ContainerPort: port.ContainerPort,
+			Protocol:      portProtocol(port),
+		})
+	}
+	return ports
 }
 
-// pointer returns a pointer to the provided value
-func pointer[T any](v T) *T {
-	return &v
+// buildServicePorts constructs the Kubernetes Service ports for the service
+func buildServicePorts(svcSpec inspectv1alpha1.ServiceSpec) []corev1.ServicePort {
+	var ports []corev1.ServicePort
+	for _, port := range svcSpec.Ports {
+		ports = append(ports, corev1.ServicePort{
+			Name:       portName(port),
+			Port:       port.ContainerPort,
+			TargetPort: intstr.FromString(portName(port)),
+			Protocol:   portProtocol(port),
+		})
+	}
+	return ports
 }
 
-// reconcileNetworkPolicies ensures Cilium Network Policies exist for the InspectSandbox
-func (r *InspectSandboxReconciler) reconcileNetworkPolicies(
-	ctx context.Context,
-	sandbox *inspectv1alpha1.InspectSandbox,
-) error {
-	logger := log.FromContext(ctx)
-	logger.Info("Reconciling network policies", "sandbox", sandbox.Name)
-
-	// Reconcile default egress policy (for allowed domains)
-	if err := r.reconcileSandboxEgressPolicy(ctx, sandbox); err != nil {
-		return err
+// portName returns the port's name, generating one if it isn't set since
+// Services with more than one port require every port to be named
+func portName(port inspectv1alpha1.ServicePort) string {
+	if port.Name != "" {
+		return port.Name
 	}
+	return fmt.Sprintf("%s-%d", strings.ToLower(string(portProtocol(port))), port.ContainerPort)
+}
 
-	// Reconcile default deny policy (to deny all ingress by default)
-	if err := r.reconcileDefaultDenyIngressPolicy(ctx, sandbox); err != nil {
-		return err
+// portProtocol returns the port's protocol, defaulting to TCP
+func portProtocol(port inspectv1alpha1.ServicePort) corev1.Protocol {
+	if port.Protocol == "" {
+		return corev1.ProtocolTCP
 	}
-
-	// Reconcile network-specific ingress policies for each network
-	for networkName := range sandbox.Spec.Networks {
-		if err := r.reconcileNetworkIngressPolicy(ctx, sandbox, networkName); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return port.Protocol
 }
 
-// reconcileSandboxEgressPolicy ensures an egress policy exists that allows:
-// - DNS lookups for allowed domains
-// - Communication between pods in the same sandbox
-// - Communication to any allowed domains
-func (r *InspectSandboxReconciler) reconcileSandboxEgressPolicy(
-	ctx context.Context,
+// buildPersistentVolumeClaim constructs a PersistentVolumeClaim for the volume
+func buildPersistentVolumeClaim(
 	sandbox *inspectv1alpha1.InspectSandbox,
-) error {
-	policyName := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-egress", sandbox.Name),
-		Namespace: sandbox.Namespace,
+	volName string,
+	volSpec inspectv1alpha1.VolumeSpec,
+) (corev1.PersistentVolumeClaim, error) {
+	size := volSpec.Size
+	if size == "" {
+		size = defaultVolumeSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return corev1.PersistentVolumeClaim{}, fmt.Errorf("invalid size %q for volume %s: %w", size, volName, err)
 	}
 
-	// Define the policy
-	policy := buildSandboxEgressPolicy(sandbox)
+	accessModes := volSpec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
 
-	// Check if policy exists
-	var existingPolicy CiliumNetworkPolicy
-	err := r.Get(ctx, policyName, &existingPolicy)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
+	pvc := corev1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "PersistentVolumeClaim",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", sandbox.Name, volName),
+			Namespace: sandbox.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "inspectsandbox",
+				"app.kubernetes.io/instance":   sandbox.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+				"inspect.example.com/volume":   volName,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: quantity,
+				},
+			},
+		},
 	}
 
-	// Create policy if it doesn't exist, update otherwise
-	if errors.IsNotFound(err) {
-		if err := controllerutil.SetControllerReference(sandbox, &policy, r.Scheme); err != nil {
-			return err
-		}
-		return r.Create(ctx, &policy)
+	// Leave the storage class unset to use the cluster default
+	if volSpec.StorageClass != "" {
+		pvc.Spec.StorageClassName = pointer(volSpec.StorageClass)
 	}
 
-	// Update the policy spec
-	existingPolicy.Spec = policy.Spec
-	return r.Update(ctx, &existingPolicy)
+	return pvc, nil
 }
 
-// reconcileDefaultDenyIngressPolicy ensures a default deny ingress policy exists
-func (r *InspectSandboxReconciler) reconcileDefaultDenyIngressPolicy(
-	ctx context.Context,
-	sandbox *inspectv1alpha1.InspectSandbox,
-) error {
-	policyName := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-default-deny-ingress", sandbox.Name),
-		Namespace: sandbox.Namespace,
+// validateServiceVolumes checks that every volume a service mounts is
+// well-formed and declared in the sandbox spec
+func validateServiceVolumes(sandbox *inspectv1alpha1.InspectSandbox, svcSpec inspectv1alpha1.ServiceSpec) error {
+	for _, entry := range svcSpec.Volumes {
+		mount, err := inspectv1alpha1.ParseVolumeMount(entry)
+		if err != nil {
+			return err
+		}
+		if _, ok := sandbox.Spec.Volumes[mount.Name]; !ok {
+			return fmt.Errorf("volume %q is not declared in spec.volumes", mount.Name)
+		}
 	}
+	return nil
+}
 
-	// Define the policy
-	policy := buildDefaultDenyIngressPolicy(sandbox)
-
-	// Check if policy exists
-	var existingPolicy CiliumNetworkPolicy
-	err := r.Get(ctx, policyName, &existingPolicy)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
+// getStatusMessage returns a status message for the service
+func getStatusMessage(sts *appsv1.StatefulSet) string {
+	if sts.Status.ReadyReplicas > 0 {
+		return "Service is ready"
 	}
-
-	// Create policy if it doesn't exist, update otherwise
-	if errors.IsNotFound(err) {
-		if err := controllerutil.SetControllerReference(sandbox, &policy, r.Scheme); err != nil {
-			return err
-		}
-		return r.Create(ctx, &policy)
+	if sts.Status.Replicas == 0 {
+		return "Service is starting"
 	}
+	return "Service is not ready"
+}
 
-	// Update the policy spec
-	existingPolicy.Spec = policy.Spec
-	return r.Update(ctx, &existingPolicy)
+// pointer returns a pointer to the provided value
+func pointer[T any](v T) *T {
+	return &v
 }
 
-// reconcileNetworkIngressPolicy ensures a network-specific ingress policy exists
-func (r *InspectSandboxReconciler) reconcileNetworkIngressPolicy(
+// reconcileNetworkPolicies ensures the sandbox's network policies exist
+func (r *InspectSandboxReconciler) reconcileNetworkPolicies(
 	ctx context.Context,
 	sandbox *inspectv1alpha1.InspectSandbox,
-	networkName string,
 ) error {
-	policyName := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-network-%s-ingress", sandbox.Name, networkName),
-		Namespace: sandbox.Namespace,
-	}
-
-	// Define the policy
-	policy := buildNetworkIngressPolicy(sandbox, networkName)
-
-	// Check if policy exists
-	var existingPolicy CiliumNetworkPolicy
-	err := r.Get(ctx, policyName, &existingPolicy)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
-	}
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling network policies", "sandbox", sandbox.Name,
+		"backend", r.networkPolicyBackend())
 
-	// Create policy if it doesn't exist, update otherwise
-	if errors.IsNotFound(err) {
-		if err := controllerutil.SetControllerReference(sandbox, &policy, r.Scheme); err != nil {
+	for _, policy := range buildNetworkPolicies(sandbox, r.networkPolicyBackend()) {
+		if err := r.applyObject(ctx, sandbox, policy); err != nil {
 			return err
 		}
-		return r.Create(ctx, &policy)
 	}
-
-	// Update the policy spec
-	existingPolicy.Spec = policy.Spec
-	return r.Update(ctx, &existingPolicy)
+	return nil
 }
 
-// buildSandboxEgressPolicy constructs an egress policy for the sandbox
-func buildSandboxEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) CiliumNetworkPolicy {
+// buildSandboxEgressPolicy constructs an egress policy for the sandbox that allows:
+// - DNS lookups for allowed domains
+// - Communication between pods in the same sandbox
+// - Communication to any allowed domains
+func buildSandboxEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) ciliumv2.CiliumNetworkPolicy {
 	// Build the policy spec
-	egressRules := []map[string]interface{}{
+	egressRules := []ciliumv2.EgressRule{
 		// Allow DNS lookups
 		{
-			"toEndpoints": []map[string]interface{}{
+			ToEndpoints: []ciliumv2.EndpointSelector{
 				{
-					"matchLabels": map[string]string{
+					MatchLabels: map[string]string{
 						"io.kubernetes.pod.namespace": "kube-system",
 						"k8s-app":                     "kube-dns",
 					},
 				},
 			},
-			"toPorts": []map[string]interface{}{
+			ToPorts: []ciliumv2.PortRule{
 				{
-					"ports": []map[string]interface{}{
-						{
-							"port":     "53",
-							"protocol": "UDP",
-						},
-						{
-							"port":     "53",
-							"protocol": "TCP",
-						},
+					Ports: []ciliumv2.PortProtocol{
+						{Port: "53", Protocol: ciliumv2.ProtoUDP},
+						{Port: "53", Protocol: ciliumv2.ProtoTCP},
 					},
-					"rules": map[string]interface{}{
-						"dns": []map[string]interface{}{
-							{
-								"matchPattern": "*",
-							},
+					Rules: &ciliumv2.L7Rules{
+						DNS: []ciliumv2.PortRuleDNS{
+							{MatchPattern: "*"},
 						},
 					},
 				},
@@ -523,9 +688,9 @@ func buildSandboxEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) CiliumNet
 		},
 		// Allow communication within the sandbox
 		{
-			"toEndpoints": []map[string]interface{}{
+			ToEndpoints: []ciliumv2.EndpointSelector{
 				{
-					"matchLabels": map[string]string{
+					MatchLabels: map[string]string{
 						"app.kubernetes.io/instance": sandbox.Name,
 					},
 				},
@@ -535,34 +700,21 @@ func buildSandboxEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) CiliumNet
 
 	// Allow specific domains if specified
 	if len(sandbox.Spec.AllowDomains) > 0 {
-		// Try a different approach for domain rules
-		domainRule := map[string]interface{}{
-			"toFQDNs": []map[string]interface{}{},
-		}
-
+		var fqdns []ciliumv2.FQDNSelector
 		for _, domain := range sandbox.Spec.AllowDomains {
-			domainRule["toFQDNs"] = append(
-				domainRule["toFQDNs"].([]map[string]interface{}),
-				map[string]interface{}{
-					"matchName": domain,
-				},
-			)
-
-			// Add wildcard subdomain
-			domainRule["toFQDNs"] = append(
-				domainRule["toFQDNs"].([]map[string]interface{}),
-				map[string]interface{}{
-					"matchPattern": fmt.Sprintf("*.%s", domain),
-				},
+			fqdns = append(fqdns,
+				ciliumv2.FQDNSelector{MatchName: domain},
+				// Add wildcard subdomain
+				ciliumv2.FQDNSelector{MatchPattern: fmt.Sprintf("*.%s", domain)},
 			)
 		}
 
-		egressRules = append(egressRules, domainRule)
+		egressRules = append(egressRules, ciliumv2.EgressRule{ToFQDNs: fqdns})
 	}
 
-	return CiliumNetworkPolicy{
+	return ciliumv2.CiliumNetworkPolicy{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "cilium.io/v2",
+			APIVersion: ciliumv2.GroupVersion.String(),
 			Kind:       "CiliumNetworkPolicy",
 		},
 		ObjectMeta: metav1.ObjectMeta{
@@ -574,22 +726,22 @@ func buildSandboxEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) CiliumNet
 				"app.kubernetes.io/managed-by": "inspect-operator",
 			},
 		},
-		Spec: map[string]interface{}{
-			"endpointSelector": map[string]interface{}{
-				"matchLabels": map[string]string{
+		Spec: ciliumv2.Rule{
+			EndpointSelector: ciliumv2.EndpointSelector{
+				MatchLabels: map[string]string{
 					"app.kubernetes.io/instance": sandbox.Name,
 				},
 			},
-			"egress": egressRules,
+			Egress: egressRules,
 		},
 	}
 }
 
 // buildDefaultDenyIngressPolicy constructs a default deny ingress policy
-func buildDefaultDenyIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox) CiliumNetworkPolicy {
-	return CiliumNetworkPolicy{
+func buildDefaultDenyIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox) ciliumv2.CiliumNetworkPolicy {
+	return ciliumv2.CiliumNetworkPolicy{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "cilium.io/v2",
+			APIVersion: ciliumv2.GroupVersion.String(),
 			Kind:       "CiliumNetworkPolicy",
 		},
 		ObjectMeta: metav1.ObjectMeta{
@@ -601,25 +753,27 @@ func buildDefaultDenyIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox) Cili
 				"app.kubernetes.io/managed-by": "inspect-operator",
 			},
 		},
-		Spec: map[string]interface{}{
-			"endpointSelector": map[string]interface{}{
-				"matchLabels": map[string]string{
+		Spec: ciliumv2.Rule{
+			EndpointSelector: ciliumv2.EndpointSelector{
+				MatchLabels: map[string]string{
 					"app.kubernetes.io/instance": sandbox.Name,
 				},
 			},
-			// Empty ingress rules to deny all incoming traffic
-			"ingress": []map[string]interface{}{},
+			// A single empty rule puts the pods into default deny without
+			// allowing anything. An empty list would be omitted and leave
+			// ingress unrestricted.
+			Ingress: []ciliumv2.IngressRule{{}},
 		},
 	}
 }
 
 // buildNetworkIngressPolicy constructs a network-specific ingress policy
-func buildNetworkIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox, networkName string) CiliumNetworkPolicy {
+func buildNetworkIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox, networkName string) ciliumv2.CiliumNetworkPolicy {
 	networkLabel := fmt.Sprintf("inspect.example.com/network-%s", networkName)
 
-	return CiliumNetworkPolicy{
+	return ciliumv2.CiliumNetworkPolicy{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "cilium.io/v2",
+			APIVersion: ciliumv2.GroupVersion.String(),
 			Kind:       "CiliumNetworkPolicy",
 		},
 		ObjectMeta: metav1.ObjectMeta{
@@ -632,18 +786,18 @@ func buildNetworkIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox, networkN
 				"inspect.example.com/network":  networkName,
 			},
 		},
-		Spec: map[string]interface{}{
-			"endpointSelector": map[string]interface{}{
-				"matchLabels": map[string]string{
+		Spec: ciliumv2.Rule{
+			EndpointSelector: ciliumv2.EndpointSelector{
+				MatchLabels: map[string]string{
 					"app.kubernetes.io/instance": sandbox.Name,
 					networkLabel:                 "true",
 				},
 			},
-			"ingress": []map[string]interface{}{
+			Ingress: []ciliumv2.IngressRule{
 				{
-					"fromEndpoints": []map[string]interface{}{
+					FromEndpoints: []ciliumv2.EndpointSelector{
 						{
-							"matchLabels": map[string]string{
+							MatchLabels: map[string]string{
 								"app.kubernetes.io/instance": sandbox.Name,
 								networkLabel:                 "true",
 							},
@@ -657,52 +811,28 @@ func buildNetworkIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox, networkN
 
 // SetupWithManager sets up the controller with the Manager
 func (r *InspectSandboxReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	// Register our custom CiliumNetworkPolicy type with the scheme
-	scheme := mgr.GetScheme()
-
-	// Define the GroupVersion
-	groupVersion := schema.GroupVersion{Group: "cilium.io", Version: "v2"}
-
-	// Create a SchemeBuilder that adds both types
-	schemeBuilder := runtime.NewSchemeBuilder(func(scheme *runtime.Scheme) error {
-		scheme.AddKnownTypes(groupVersion,
-			&CiliumNetworkPolicy{},
-			&CiliumNetworkPolicyList{},
-		)
-		metav1.AddToGroupVersion(scheme, groupVersion)
-		return nil
-	})
-
-	// Add the types to the scheme
-	if err := schemeBuilder.AddToScheme(scheme); err != nil {
+	if err := metrics.Registry.Register(newSandboxCollector(mgr.GetClient())); err != nil {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	// Watch everything the sandbox creates so edits and deletions are
+	// repaired straight away
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&inspectv1alpha1.InspectSandbox{}).
 		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
-		Complete(r)
-}
-
-// CiliumNetworkPolicyList contains a list of CiliumNetworkPolicy
-type CiliumNetworkPolicyList struct {
-	metav1.TypeMeta `json:",inline"`
-	metav1.ListMeta `json:"metadata,omitempty"`
-	Items           []CiliumNetworkPolicy `json:"items"`
-}
-
-// DeepCopyObject implements runtime.Object interface
-func (p *CiliumNetworkPolicyList) DeepCopyObject() runtime.Object {
-	c := &CiliumNetworkPolicyList{
-		TypeMeta: p.TypeMeta,
-		ListMeta: *p.ListMeta.DeepCopy(),
-		Items:    make([]CiliumNetworkPolicy, len(p.Items)),
-	}
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		// Pods belong to the StatefulSets, so map them back by label to pick
+		// up IP, restart and termination changes
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(podToSandbox)).
+		Watches(&inspectv1alpha1.InspectSandboxTemplate{}, handler.EnqueueRequestsFromMapFunc(r.templateToSandboxes))
 
-	for i, item := range p.Items {
-		c.Items[i] = *item.DeepCopyObject().(*CiliumNetworkPolicy)
+	// The Cilium types can only be watched when their CRDs are installed
+	if r.networkPolicyBackend() == NetworkPolicyBackendCilium {
+		builder = builder.Owns(&ciliumv2.CiliumNetworkPolicy{})
 	}
 
-	return c
+	return builder.Complete(r)
 }
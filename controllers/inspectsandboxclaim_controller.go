@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// InspectSandboxClaimReconciler binds InspectSandboxClaims to ready
+// sandboxes from their pool
+type InspectSandboxClaimReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// APIReader reads sandboxes straight from the API server where the
+	// cache may not have caught up with a bind yet
+	APIReader client.Reader
+
+	// Recorder emits events on claims
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxclaims,verbs=get;list;watch
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxclaims/status,verbs=get;update;patch
+
+// Reconcile binds the claim to the oldest ready idle sandbox in its pool,
+// or reports the state of the sandbox it already holds
+func (r *InspectSandboxClaimReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling InspectSandboxClaim", "request", req.NamespacedName)
+
+	var claim inspectv1alpha1.InspectSandboxClaim
+	if err := r.Get(ctx, req.NamespacedName, &claim); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The bound sandbox is garbage collected along with the claim
+	if !claim.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if claim.Status.SandboxName != "" {
+		return ctrl.Result{}, r.updateBoundStatus(ctx, &claim)
+	}
+
+	// A previous bind may have taken a sandbox but failed to record it in
+	// status, in which case finish that bind rather than taking another
+	adopted, err := r.claimedSandbox(ctx, &claim)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if adopted != nil {
+		return ctrl.Result{}, r.recordBinding(ctx, &claim, adopted)
+	}
+
+	var pool inspectv1alpha1.InspectSandboxPool
+	err = r.Get(ctx, types.NamespacedName{Name: claim.Spec.PoolName, Namespace: claim.Namespace}, &pool)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, r.setPending(ctx, &claim, fmt.Sprintf("Pool %s not found", claim.Spec.PoolName))
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	candidates, err := r.readySandboxes(ctx, &pool)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range candidates {
+		bound, err := r.bind(ctx, &claim, &pool, &candidates[i])
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if bound {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// Sandboxes in the pool becoming ready trigger another attempt
+	return ctrl.Result{}, r.setPending(ctx, &claim,
+		fmt.Sprintf("Waiting for a ready sandbox in pool %s", pool.Name))
+}
+
+// readySandboxes returns the pool's ready idle sandboxes, oldest first
+func (r *InspectSandboxClaimReconciler) readySandboxes(
+	ctx context.Context,
+	pool *inspectv1alpha1.InspectSandboxPool,
+) ([]inspectv1alpha1.InspectSandbox, error) {
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := r.List(ctx, &sandboxes,
+		client.InNamespace(pool.Namespace),
+		client.MatchingLabels{inspectv1alpha1.PoolLabel: pool.Name},
+	); err != nil {
+		return nil, err
+	}
+
+	var ready []inspectv1alpha1.InspectSandbox
+	for _, sandbox := range sandboxes.Items {
+		if isIdlePoolSandbox(&sandbox) && metav1.IsControlledBy(&sandbox, pool) &&
+			sandbox.Status.Phase == inspectv1alpha1.PhaseReady {
+			ready = append(ready, sandbox)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].CreationTimestamp.Before(&ready[j].CreationTimestamp)
+	})
+	return ready, nil
+}
+
+// bind hands sandbox over from the pool to the claim. The update carries
+// the sandbox's resourceVersion, so if another claim or the pool got to it
+// first it fails with a conflict and false is returned to try the next one.
+func (r *InspectSandboxClaimReconciler) bind(
+	ctx context.Context,
+	claim *inspectv1alpha1.InspectSandboxClaim,
+	pool *inspectv1alpha1.InspectSandboxPool,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (bool, error) {
+	if err := controllerutil.RemoveControllerReference(pool, sandbox, r.Scheme); err != nil {
+		return false, err
+	}
+	if err := controllerutil.SetControllerReference(claim, sandbox, r.Scheme); err != nil {
+		return false, err
+	}
+	sandbox.Labels[inspectv1alpha1.ClaimLabel] = claim.Name
+	if sandbox.Annotations == nil {
+		sandbox.Annotations = map[string]string{}
+	}
+	now := metav1.Now()
+	sandbox.Annotations[inspectv1alpha1.ClaimedAtAnnotation] = now.UTC().Format(time.RFC3339)
+
+	if err := r.Update(ctx, sandbox); err != nil {
+		if errors.IsConflict(err) || errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Bound sandbox to claim", "sandbox", sandbox.Name)
+	r.Recorder.Eventf(claim, corev1.EventTypeNormal, eventReasonBound,
+		"Bound sandbox %s from pool %s", sandbox.Name, pool.Name)
+	return true, r.recordBinding(ctx, claim, sandbox)
+}
+
+// claimedSandbox returns the sandbox the claim has already taken over, or
+// nil if it hasn't taken one. The sandbox's controller reference, not the
+// claim's status, is the record of a bind. It is read from the API server,
+// as a cache that hasn't seen the last bind yet would have the claim take
+// a second sandbox.
+func (r *InspectSandboxClaimReconciler) claimedSandbox(
+	ctx context.Context,
+	claim *inspectv1alpha1.InspectSandboxClaim,
+) (*inspectv1alpha1.InspectSandbox, error) {
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := r.APIReader.List(ctx, &sandboxes,
+		client.InNamespace(claim.Namespace),
+		client.MatchingLabels{inspectv1alpha1.ClaimLabel: claim.Name},
+	); err != nil {
+		return nil, err
+	}
+	for i := range sandboxes.Items {
+		if metav1.IsControlledBy(&sandboxes.Items[i], claim) {
+			return &sandboxes.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// recordBinding saves the sandbox bound to the claim in its status
+func (r *InspectSandboxClaimReconciler) recordBinding(
+	ctx context.Context,
+	claim *inspectv1alpha1.InspectSandboxClaim,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) error {
+	boundTime := metav1.Now()
+	if claimedAt, err := time.Parse(time.RFC3339, sandbox.Annotations[inspectv1alpha1.ClaimedAtAnnotation]); err == nil {
+		boundTime = metav1.NewTime(claimedAt)
+	}
+
+	claim.Status.Phase = inspectv1alpha1.ClaimBound
+	claim.Status.SandboxName = sandbox.Name
+	claim.Status.BoundTime = &boundTime
+	claim.Status.Message = fmt.Sprintf("Bound to sandbox %s", sandbox.Name)
+	return r.Status().Update(ctx, claim)
+}
+
+// updateBoundStatus reports whether the claim's sandbox still exists
+func (r *InspectSandboxClaimReconciler) updateBoundStatus(
+	ctx context.Context,
+	claim *inspectv1alpha1.InspectSandboxClaim,
+) error {
+	var sandbox inspectv1alpha1.InspectSandbox
+	err := r.Get(ctx, types.NamespacedName{Name: claim.Status.SandboxName, Namespace: claim.Namespace}, &sandbox)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	phase := inspectv1alpha1.ClaimBound
+	message := fmt.Sprintf("Bound to sandbox %s", sandbox.Name)
+	if errors.IsNotFound(err) || !sandbox.DeletionTimestamp.IsZero() {
+		phase = inspectv1alpha1.ClaimLost
+		message = fmt.Sprintf("Sandbox %s has been deleted", claim.Status.SandboxName)
+	}
+	if claim.Status.Phase == phase && claim.Status.Message == message {
+		return nil
+	}
+	if phase == inspectv1alpha1.ClaimLost {
+		r.Recorder.Event(claim, corev1.EventTypeWarning, eventReasonLost, message)
+	}
+	claim.Status.Phase = phase
+	claim.Status.Message = message
+	return r.Status().Update(ctx, claim)
+}
+
+// setPending records that the claim is still waiting for a sandbox
+func (r *InspectSandboxClaimReconciler) setPending(
+	ctx context.Context,
+	claim *inspectv1alpha1.InspectSandboxClaim,
+	message string,
+) error {
+	if claim.Status.Phase == inspectv1alpha1.ClaimPending && claim.Status.Message == message {
+		return nil
+	}
+	claim.Status.Phase = inspectv1alpha1.ClaimPending
+	claim.Status.Message = message
+	return r.Status().Update(ctx, claim)
+}
+
+// poolSandboxToClaims maps an idle pooled sandbox to the unbound claims on
+// its pool, so they are retried when it becomes ready
+func (r *InspectSandboxClaimReconciler) poolSandboxToClaims(ctx context.Context, obj client.Object) []reconcile.Request {
+	sandbox, ok := obj.(*inspectv1alpha1.InspectSandbox)
+	if !ok || !isIdlePoolSandbox(sandbox) || sandbox.Status.Phase != inspectv1alpha1.PhaseReady {
+		return nil
+	}
+
+	var claims inspectv1alpha1.InspectSandboxClaimList
+	if err := r.List(ctx, &claims, client.InNamespace(sandbox.Namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list claims for pooled sandbox", "sandbox", sandbox.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, claim := range claims.Items {
+		if claim.Spec.PoolName == sandbox.Labels[inspectv1alpha1.PoolLabel] && claim.Status.SandboxName == "" {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: claim.Name, Namespace: claim.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *InspectSandboxClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&inspectv1alpha1.InspectSandboxClaim{}).
+		// Bound sandboxes are owned by their claim
+		Owns(&inspectv1alpha1.InspectSandbox{}).
+		Watches(&inspectv1alpha1.InspectSandbox{}, handler.EnqueueRequestsFromMapFunc(r.poolSandboxToClaims)).
+		Complete(r)
+}
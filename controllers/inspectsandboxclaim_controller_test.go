@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newClaim returns a claim called run on the warm pool
+func newClaim() *inspectv1alpha1.InspectSandboxClaim {
+	return &inspectv1alpha1.InspectSandboxClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "evals", UID: "run-uid"},
+		Spec:       inspectv1alpha1.InspectSandboxClaimSpec{PoolName: "warm"},
+	}
+}
+
+func TestInspectSandboxClaimReconcile(t *testing.T) {
+	pool := newPool(2)
+	hash, err := templateHash(&pool.Spec.Template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		objs        func(t *testing.T) []client.Object
+		status      inspectv1alpha1.InspectSandboxClaimStatus
+		funcs       interceptor.Funcs
+		wantPhase   inspectv1alpha1.ClaimPhase
+		wantSandbox string
+		wantMessage string
+	}{
+		{
+			name:        "pool missing",
+			wantPhase:   inspectv1alpha1.ClaimPending,
+			wantMessage: "Pool warm not found",
+		},
+		{
+			name: "no ready sandbox",
+			objs: func(t *testing.T) []client.Object {
+				return []client.Object{pool, poolSandbox(t, pool, "warm-a", hash, inspectv1alpha1.PhaseProvisioning, time.Hour)}
+			},
+			wantPhase:   inspectv1alpha1.ClaimPending,
+			wantMessage: "Waiting for a ready sandbox in pool warm",
+		},
+		{
+			name: "binds the oldest ready sandbox",
+			objs: func(t *testing.T) []client.Object {
+				return []client.Object{
+					pool,
+					poolSandbox(t, pool, "warm-new", hash, inspectv1alpha1.PhaseReady, time.Minute),
+					poolSandbox(t, pool, "warm-old", hash, inspectv1alpha1.PhaseReady, time.Hour),
+					poolSandbox(t, pool, "warm-oldest", hash, inspectv1alpha1.PhaseProvisioning, 2*time.Hour),
+				}
+			},
+			wantPhase:   inspectv1alpha1.ClaimBound,
+			wantSandbox: "warm-old",
+			wantMessage: "Bound to sandbox warm-old",
+		},
+		{
+			name: "skips a sandbox taken by someone else",
+			objs: func(t *testing.T) []client.Object {
+				return []client.Object{
+					pool,
+					poolSandbox(t, pool, "warm-new", hash, inspectv1alpha1.PhaseReady, time.Minute),
+					poolSandbox(t, pool, "warm-old", hash, inspectv1alpha1.PhaseReady, time.Hour),
+				}
+			},
+			funcs: interceptor.Funcs{
+				Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+					if obj.GetName() == "warm-old" {
+						return apierrors.NewConflict(schema.GroupResource{Resource: "inspectsandboxes"}, obj.GetName(), nil)
+					}
+					return c.Update(ctx, obj, opts...)
+				},
+			},
+			wantPhase:   inspectv1alpha1.ClaimBound,
+			wantSandbox: "warm-new",
+			wantMessage: "Bound to sandbox warm-new",
+		},
+		{
+			name: "adopts a sandbox bound before status was saved",
+			objs: func(t *testing.T) []client.Object {
+				taken := poolSandbox(t, pool, "warm-taken", hash, inspectv1alpha1.PhaseReady, time.Minute)
+				taken.Labels[inspectv1alpha1.ClaimLabel] = "run"
+				taken.Annotations[inspectv1alpha1.ClaimedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+				if err := controllerutil.RemoveControllerReference(pool, taken, testScheme); err != nil {
+					t.Fatal(err)
+				}
+				if err := controllerutil.SetControllerReference(newClaim(), taken, testScheme); err != nil {
+					t.Fatal(err)
+				}
+				return []client.Object{
+					pool,
+					taken,
+					poolSandbox(t, pool, "warm-free", hash, inspectv1alpha1.PhaseReady, time.Hour),
+				}
+			},
+			wantPhase:   inspectv1alpha1.ClaimBound,
+			wantSandbox: "warm-taken",
+			wantMessage: "Bound to sandbox warm-taken",
+		},
+		{
+			name:        "bound sandbox deleted",
+			objs:        func(t *testing.T) []client.Object { return []client.Object{pool} },
+			status:      inspectv1alpha1.InspectSandboxClaimStatus{Phase: inspectv1alpha1.ClaimBound, SandboxName: "warm-old"},
+			wantPhase:   inspectv1alpha1.ClaimLost,
+			wantSandbox: "warm-old",
+			wantMessage: "Sandbox warm-old has been deleted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := newClaim()
+			claim.Status = tt.status
+			objs := []client.Object{claim}
+			if tt.objs != nil {
+				objs = append(objs, tt.objs(t)...)
+			}
+			c := interceptor.NewClient(newFakeClient(objs...), tt.funcs)
+			r := &InspectSandboxClaimReconciler{Client: c, Scheme: testScheme, APIReader: c, Recorder: record.NewFakeRecorder(100)}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(claim)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got inspectv1alpha1.InspectSandboxClaim
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(claim), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != tt.wantPhase || got.Status.SandboxName != tt.wantSandbox || got.Status.Message != tt.wantMessage {
+				t.Errorf("status = %s %q %q, want %s %q %q", got.Status.Phase, got.Status.SandboxName, got.Status.Message,
+					tt.wantPhase, tt.wantSandbox, tt.wantMessage)
+			}
+
+			// The claim ends up controlling exactly the sandbox it reports
+			held := controlledSandboxes(t, c, claim)
+			if tt.wantPhase != inspectv1alpha1.ClaimBound {
+				if len(held) != 0 {
+					t.Errorf("claim controls %d sandboxes, want none", len(held))
+				}
+				return
+			}
+			if len(held) != 1 || held[0].Name != tt.wantSandbox {
+				t.Fatalf("claim controls %v, want only %s", sandboxNames(held), tt.wantSandbox)
+			}
+			if held[0].Labels[inspectv1alpha1.ClaimLabel] != "run" || held[0].Annotations[inspectv1alpha1.ClaimedAtAnnotation] == "" {
+				t.Errorf("bound sandbox isn't marked as claimed: %v %v", held[0].Labels, held[0].Annotations)
+			}
+			if got.Status.BoundTime == nil {
+				t.Error("boundTime not set")
+			}
+		})
+	}
+}
+
+// TestInspectSandboxClaimStaleCache checks that claims reading from a cache
+// that hasn't caught up with earlier binds never end up sharing a sandbox
+// or holding two
+func TestInspectSandboxClaimStaleCache(t *testing.T) {
+	pool := newPool(2)
+	hash, err := templateHash(&pool.Spec.Template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newClaim()
+	other.Name = "other"
+	other.UID = "other-uid"
+
+	tests := []struct {
+		name       string
+		claims     []*inspectv1alpha1.InspectSandboxClaim
+		sandboxes  []string
+		reconciles []string
+		want       map[string][]string
+	}{
+		{
+			name:       "two claims for one free sandbox",
+			claims:     []*inspectv1alpha1.InspectSandboxClaim{newClaim(), other},
+			sandboxes:  []string{"warm-a"},
+			reconciles: []string{"run", "other"},
+			want:       map[string][]string{"run": {"warm-a"}, "other": nil},
+		},
+		{
+			name:       "one claim reconciled twice",
+			claims:     []*inspectv1alpha1.InspectSandboxClaim{newClaim()},
+			sandboxes:  []string{"warm-a", "warm-b"},
+			reconciles: []string{"run", "run"},
+			want:       map[string][]string{"run": {"warm-a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{pool}
+			for _, claim := range tt.claims {
+				objs = append(objs, claim)
+			}
+			for i, name := range tt.sandboxes {
+				// Earlier sandboxes are older, so bound first
+				age := time.Duration(len(tt.sandboxes)-i) * time.Hour
+				objs = append(objs, poolSandbox(t, pool, name, hash, inspectv1alpha1.PhaseReady, age))
+			}
+
+			// Reads come from a snapshot of the objects as they started,
+			// as if the cache never saw any of the writes
+			live := newFakeClient(objs...)
+			snapshot := make([]client.Object, 0, len(objs))
+			for _, obj := range objs {
+				snapshot = append(snapshot, obj.DeepCopyObject().(client.Object))
+			}
+			stale := newFakeClient(snapshot...)
+			cached := interceptor.NewClient(live, interceptor.Funcs{
+				Get: func(ctx context.Context, _ client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return stale.Get(ctx, key, obj, opts...)
+				},
+				List: func(ctx context.Context, _ client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					return stale.List(ctx, list, opts...)
+				},
+			})
+			r := &InspectSandboxClaimReconciler{Client: cached, Scheme: testScheme, APIReader: live, Recorder: record.NewFakeRecorder(100)}
+
+			for _, name := range tt.reconciles {
+				// Writes based on stale reads may conflict, which only
+				// requeues the claim
+				_, err := r.Reconcile(context.Background(), ctrl.Request{
+					NamespacedName: client.ObjectKey{Name: name, Namespace: "evals"},
+				})
+				if err != nil && !apierrors.IsConflict(err) {
+					t.Fatalf("unexpected error reconciling %s: %v", name, err)
+				}
+			}
+
+			for _, claim := range tt.claims {
+				held := sandboxNames(controlledSandboxes(t, live, claim))
+				if len(held) == 0 {
+					held = nil
+				}
+				if !reflect.DeepEqual(held, tt.want[claim.Name]) {
+					t.Errorf("claim %s controls %v, want %v", claim.Name, held, tt.want[claim.Name])
+				}
+			}
+		})
+	}
+}
+
+// sandboxNames returns the names of sandboxes
+func sandboxNames(sandboxes []inspectv1alpha1.InspectSandbox) []string {
+	names := make([]string, 0, len(sandboxes))
+	for _, sandbox := range sandboxes {
+		names = append(names, sandbox.Name)
+	}
+	return names
+}
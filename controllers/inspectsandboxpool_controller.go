@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// InspectSandboxPoolReconciler keeps InspectSandboxPools topped up with
+// idle sandboxes
+type InspectSandboxPoolReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Recorder emits events on pools
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxpools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxpools/status,verbs=get;update;patch
+
+// Reconcile creates and deletes idle sandboxes until the pool has the
+// desired number built from its current template
+func (r *InspectSandboxPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling InspectSandboxPool", "request", req.NamespacedName)
+
+	var pool inspectv1alpha1.InspectSandboxPool
+	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Owned sandboxes are garbage collected along with the pool
+	if !pool.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	hash, err := templateHash(&pool.Spec.Template)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	idle, err := r.idleSandboxes(ctx, &pool)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Replace idle sandboxes built from an older template
+	var current []inspectv1alpha1.InspectSandbox
+	for i := range idle {
+		if idle[i].Annotations[inspectv1alpha1.TemplateHashAnnotation] == hash {
+			current = append(current, idle[i])
+			continue
+		}
+		if err := r.deleteIdleSandbox(ctx, &pool, &idle[i], "its template is out of date"); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Keep the sandboxes closest to being claimable: ready before not
+	// ready, then oldest first
+	sort.SliceStable(current, func(i, j int) bool {
+		iReady := current[i].Status.Phase == inspectv1alpha1.PhaseReady
+		jReady := current[j].Status.Phase == inspectv1alpha1.PhaseReady
+		if iReady != jReady {
+			return iReady
+		}
+		return current[i].CreationTimestamp.Before(&current[j].CreationTimestamp)
+	})
+
+	desired := int(pool.Spec.Replicas)
+	for len(current) > desired {
+		excess := current[len(current)-1]
+		if err := r.deleteIdleSandbox(ctx, &pool, &excess, "the pool has too many idle sandboxes"); err != nil {
+			return ctrl.Result{}, err
+		}
+		current = current[:len(current)-1]
+	}
+
+	for len(current) < desired {
+		sandbox, err := r.createPoolSandbox(ctx, &pool, hash)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		current = append(current, *sandbox)
+	}
+
+	// Update status
+	pool.Status.Replicas = int32(len(current))
+	pool.Status.ReadyReplicas = 0
+	for _, sandbox := range current {
+		if sandbox.Status.Phase == inspectv1alpha1.PhaseReady {
+			pool.Status.ReadyReplicas++
+		}
+	}
+	pool.Status.ObservedGeneration = pool.Generation
+	if err := r.Status().Update(ctx, &pool); err != nil {
+		logger.Error(err, "Failed to update InspectSandboxPool status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// idleSandboxes returns the pool's sandboxes that haven't been claimed
+func (r *InspectSandboxPoolReconciler) idleSandboxes(
+	ctx context.Context,
+	pool *inspectv1alpha1.InspectSandboxPool,
+) ([]inspectv1alpha1.InspectSandbox, error) {
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := r.List(ctx, &sandboxes,
+		client.InNamespace(pool.Namespace),
+		client.MatchingLabels{inspectv1alpha1.PoolLabel: pool.Name},
+	); err != nil {
+		return nil, err
+	}
+
+	var idle []inspectv1alpha1.InspectSandbox
+	for _, sandbox := range sandboxes.Items {
+		if isIdlePoolSandbox(&sandbox) && metav1.IsControlledBy(&sandbox, pool) {
+			idle = append(idle, sandbox)
+		}
+	}
+	return idle, nil
+}
+
+// createPoolSandbox creates an idle sandbox from the pool's template
+func (r *InspectSandboxPoolReconciler) createPoolSandbox(
+	ctx context.Context,
+	pool *inspectv1alpha1.InspectSandboxPool,
+	hash string,
+) (*inspectv1alpha1.InspectSandbox, error) {
+	sandbox := buildPoolSandbox(pool, hash)
+	if err := controllerutil.SetControllerReference(pool, sandbox, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, sandbox); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Created pooled sandbox", "name", sandbox.Name)
+	r.Recorder.Eventf(pool, corev1.EventTypeNormal, eventReasonCreated, "Created idle sandbox %s", sandbox.Name)
+	return sandbox, nil
+}
+
+// deleteIdleSandbox deletes an idle sandbox, unless a claim has bound it
+// since it was read
+func (r *InspectSandboxPoolReconciler) deleteIdleSandbox(
+	ctx context.Context,
+	pool *inspectv1alpha1.InspectSandboxPool,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	why string,
+) error {
+	// The precondition stops us deleting a sandbox a claim has just taken
+	err := r.Delete(ctx, sandbox, client.Preconditions{ResourceVersion: &sandbox.ResourceVersion})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Deleted pooled sandbox", "name", sandbox.Name, "reason", why)
+	r.Recorder.Eventf(pool, corev1.EventTypeNormal, eventReasonDeleted,
+		"Deleted idle sandbox %s because %s", sandbox.Name, why)
+	return nil
+}
+
+// buildPoolSandbox constructs an idle sandbox for the pool
+func buildPoolSandbox(pool *inspectv1alpha1.InspectSandboxPool, hash string) *inspectv1alpha1.InspectSandbox {
+	return &inspectv1alpha1.InspectSandbox{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-", pool.Name),
+			Namespace:    pool.Namespace,
+			Labels: map[string]string{
+				inspectv1alpha1.PoolLabel: pool.Name,
+			},
+			Annotations: map[string]string{
+				inspectv1alpha1.TemplateHashAnnotation: hash,
+			},
+		},
+		Spec: *pool.Spec.Template.DeepCopy(),
+	}
+}
+
+// isIdlePoolSandbox reports whether sandbox came from a pool and is still
+// waiting to be claimed
+func isIdlePoolSandbox(sandbox *inspectv1alpha1.InspectSandbox) bool {
+	_, pooled := sandbox.Labels[inspectv1alpha1.PoolLabel]
+	_, claimed := sandbox.Labels[inspectv1alpha1.ClaimLabel]
+	return pooled && !claimed && sandbox.DeletionTimestamp.IsZero()
+}
+
+// templateHash returns a short hash identifying a pool template
+func templateHash(template *inspectv1alpha1.InspectSandboxSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *InspectSandboxPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&inspectv1alpha1.InspectSandboxPool{}).
+		// Sandboxes handed to a claim stop being owned by the pool, which
+		// still sees the change and tops itself back up
+		Owns(&inspectv1alpha1.InspectSandbox{}).
+		Complete(r)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newPool returns a pool called warm in the evals namespace
+func newPool(replicas int32) *inspectv1alpha1.InspectSandboxPool {
+	return &inspectv1alpha1.InspectSandboxPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "warm", Namespace: "evals", UID: "warm-uid"},
+		Spec: inspectv1alpha1.InspectSandboxPoolSpec{
+			Replicas: replicas,
+			Template: inspectv1alpha1.InspectSandboxSpec{Services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu"},
+			}},
+		},
+	}
+}
+
+// poolSandbox returns an idle sandbox controlled by the pool, built from
+// the template with the given hash and created age ago
+func poolSandbox(
+	t *testing.T,
+	pool *inspectv1alpha1.InspectSandboxPool,
+	name, hash string,
+	phase inspectv1alpha1.SandboxPhase,
+	age time.Duration,
+) *inspectv1alpha1.InspectSandbox {
+	t.Helper()
+	sandbox := buildPoolSandbox(pool, hash)
+	sandbox.Name = name
+	sandbox.UID = types.UID(name + "-uid")
+	sandbox.CreationTimestamp = metav1.NewTime(time.Now().Add(-age).Truncate(time.Second))
+	sandbox.Status.Phase = phase
+	if err := controllerutil.SetControllerReference(pool, sandbox, testScheme); err != nil {
+		t.Fatal(err)
+	}
+	return sandbox
+}
+
+// controlledSandboxes returns the sandboxes controlled by owner, sorted by
+// name
+func controlledSandboxes(t *testing.T, c client.Client, owner metav1.Object) []inspectv1alpha1.InspectSandbox {
+	t.Helper()
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := c.List(context.Background(), &sandboxes); err != nil {
+		t.Fatal(err)
+	}
+	var controlled []inspectv1alpha1.InspectSandbox
+	for _, sandbox := range sandboxes.Items {
+		if metav1.IsControlledBy(&sandbox, owner) {
+			controlled = append(controlled, sandbox)
+		}
+	}
+	sort.Slice(controlled, func(i, j int) bool { return controlled[i].Name < controlled[j].Name })
+	return controlled
+}
+
+func TestInspectSandboxPoolReconcile(t *testing.T) {
+	pool := newPool(0)
+	hash, err := templateHash(&pool.Spec.Template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		replicas    int32
+		existing    func(t *testing.T, pool *inspectv1alpha1.InspectSandboxPool) []client.Object
+		wantKept    []string
+		wantCreated int
+		wantReady   int32
+	}{
+		{
+			name:        "fills an empty pool",
+			replicas:    3,
+			wantCreated: 3,
+		},
+		{
+			name:     "replaces sandboxes from an old template",
+			replicas: 2,
+			existing: func(t *testing.T, pool *inspectv1alpha1.InspectSandboxPool) []client.Object {
+				return []client.Object{
+					poolSandbox(t, pool, "warm-old", "stale", inspectv1alpha1.PhaseReady, time.Hour),
+					poolSandbox(t, pool, "warm-new", hash, inspectv1alpha1.PhaseReady, time.Minute),
+				}
+			},
+			wantKept:    []string{"warm-new"},
+			wantCreated: 1,
+			wantReady:   1,
+		},
+		{
+			name:     "scales down keeping ready then oldest",
+			replicas: 2,
+			existing: func(t *testing.T, pool *inspectv1alpha1.InspectSandboxPool) []client.Object {
+				return []client.Object{
+					poolSandbox(t, pool, "warm-pending-oldest", hash, inspectv1alpha1.PhaseProvisioning, 3*time.Hour),
+					poolSandbox(t, pool, "warm-ready-old", hash, inspectv1alpha1.PhaseReady, 2*time.Hour),
+					poolSandbox(t, pool, "warm-ready-new", hash, inspectv1alpha1.PhaseReady, time.Hour),
+					poolSandbox(t, pool, "warm-ready-newest", hash, inspectv1alpha1.PhaseReady, time.Minute),
+				}
+			},
+			wantKept:  []string{"warm-ready-new", "warm-ready-old"},
+			wantReady: 2,
+		},
+		{
+			name:     "claimed sandboxes don't count",
+			replicas: 1,
+			existing: func(t *testing.T, pool *inspectv1alpha1.InspectSandboxPool) []client.Object {
+				claimed := poolSandbox(t, pool, "warm-claimed", hash, inspectv1alpha1.PhaseReady, time.Hour)
+				claimed.Labels[inspectv1alpha1.ClaimLabel] = "run"
+				claimed.OwnerReferences = nil
+				return []client.Object{claimed}
+			},
+			wantCreated: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newPool(tt.replicas)
+			objs := []client.Object{pool}
+			if tt.existing != nil {
+				objs = append(objs, tt.existing(t, pool)...)
+			}
+			c := newFakeClient(objs...)
+			r := &InspectSandboxPoolReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pool)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			kept := []string{}
+			created := 0
+			existing := map[string]bool{}
+			for _, obj := range objs {
+				existing[obj.GetName()] = true
+			}
+			for _, sandbox := range controlledSandboxes(t, c, pool) {
+				if existing[sandbox.Name] {
+					kept = append(kept, sandbox.Name)
+					continue
+				}
+				created++
+				if sandbox.Annotations[inspectv1alpha1.TemplateHashAnnotation] != hash ||
+					sandbox.Labels[inspectv1alpha1.PoolLabel] != "warm" {
+					t.Errorf("created sandbox %s isn't labelled with the pool and template: %v %v",
+						sandbox.Name, sandbox.Labels, sandbox.Annotations)
+				}
+				if !reflect.DeepEqual(sandbox.Spec, pool.Spec.Template) {
+					t.Errorf("created sandbox %s has spec %+v, want the template", sandbox.Name, sandbox.Spec)
+				}
+			}
+			if tt.wantKept == nil {
+				tt.wantKept = []string{}
+			}
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created %d sandboxes, want %d", created, tt.wantCreated)
+			}
+
+			var got inspectv1alpha1.InspectSandboxPool
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pool), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Replicas != tt.replicas || got.Status.ReadyReplicas != tt.wantReady {
+				t.Errorf("status replicas = %d ready = %d, want %d ready = %d",
+					got.Status.Replicas, got.Status.ReadyReplicas, tt.replicas, tt.wantReady)
+			}
+		})
+	}
+}
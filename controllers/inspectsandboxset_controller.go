@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// InspectSandboxSetReconciler stamps out indexed sandboxes for
+// InspectSandboxSets
+type InspectSandboxSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Recorder emits events on sets
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=inspect.example.com,resources=inspectsandboxsets/status,verbs=get;update;patch
+
+// Reconcile creates, updates and deletes sandboxes so the set has one for
+// every index below replicas that hasn't completed, each built from the
+// current template
+func (r *InspectSandboxSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling InspectSandboxSet", "request", req.NamespacedName)
+
+	var set inspectv1alpha1.InspectSandboxSet
+	if err := r.Get(ctx, req.NamespacedName, &set); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Owned sandboxes are garbage collected along with the set
+	if !set.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	hash, err := templateHash(&set.Spec.Template)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := r.List(ctx, &sandboxes,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{inspectv1alpha1.SetLabel: set.Name},
+	); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Keep going when one sandbox fails so the others still converge
+	var errs []error
+
+	// Indexes scaled in past are forgotten, so scaling out again starts them
+	// afresh
+	completed := make(map[int]bool)
+	for _, index := range set.Status.CompletedIndexes {
+		if index < set.Spec.Replicas {
+			completed[int(index)] = true
+		}
+	}
+
+	// Scale in from the highest indexes, which are the ones out of range
+	byIndex := make(map[int]*inspectv1alpha1.InspectSandbox)
+	for i := range sandboxes.Items {
+		sandbox := &sandboxes.Items[i]
+		if !metav1.IsControlledBy(sandbox, &set) {
+			continue
+		}
+		index, err := strconv.Atoi(sandbox.Labels[inspectv1alpha1.SetIndexLabel])
+		if err == nil && index >= 0 && index < int(set.Spec.Replicas) {
+			byIndex[index] = sandbox
+			// A sandbox that expired is done rather than lost, unlike one
+			// deleted by hand
+			if meta.IsStatusConditionTrue(sandbox.Status.Conditions, inspectv1alpha1.ConditionExpired) {
+				completed[index] = true
+			}
+			continue
+		}
+		if !sandbox.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := r.Delete(ctx, sandbox); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info("Deleted sandbox on scale in", "name", sandbox.Name)
+		r.Recorder.Eventf(&set, corev1.EventTypeNormal, eventReasonDeleted, "Deleted sandbox %s", sandbox.Name)
+	}
+
+	set.Status.Replicas = 0
+	set.Status.ReadyReplicas = 0
+	set.Status.FailedReplicas = 0
+	set.Status.CompletedIndexes = nil
+	for index := 0; index < int(set.Spec.Replicas); index++ {
+		sandbox, ok := byIndex[index]
+		switch {
+		case completed[index]:
+			set.Status.CompletedIndexes = append(set.Status.CompletedIndexes, int32(index))
+			continue
+
+		case !ok:
+			// Scale out
+			sandbox, err = r.createSetSandbox(ctx, &set, index, hash)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+		case !sandbox.DeletionTimestamp.IsZero():
+			// Recreated once the old sandbox has gone
+			continue
+
+		case sandbox.Annotations[inspectv1alpha1.TemplateHashAnnotation] != hash:
+			if err := r.updateSetSandbox(ctx, &set, sandbox, index, hash); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		set.Status.Replicas++
+		switch sandbox.Status.Phase {
+		case inspectv1alpha1.PhaseReady:
+			set.Status.ReadyReplicas++
+		case inspectv1alpha1.PhaseFailed:
+			set.Status.FailedReplicas++
+		}
+	}
+
+	// Update status
+	wanted := set.Spec.Replicas - int32(len(set.Status.CompletedIndexes))
+	readyCondition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: set.Generation,
+		Reason:             "SandboxesNotReady",
+		Message:            fmt.Sprintf("%d of %d sandboxes are ready", set.Status.ReadyReplicas, wanted),
+	}
+	if set.Status.ReadyReplicas == wanted {
+		readyCondition.Status = metav1.ConditionTrue
+		readyCondition.Reason = "AllSandboxesReady"
+	}
+	meta.SetStatusCondition(&set.Status.Conditions, readyCondition)
+	set.Status.ObservedGeneration = set.Generation
+	if err := r.Status().Update(ctx, &set); err != nil {
+		logger.Error(err, "Failed to update InspectSandboxSet status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, kerrors.NewAggregate(errs)
+}
+
+// createSetSandbox creates the set's sandbox for index
+func (r *InspectSandboxSetReconciler) createSetSandbox(
+	ctx context.Context,
+	set *inspectv1alpha1.InspectSandboxSet,
+	index int,
+	hash string,
+) (*inspectv1alpha1.InspectSandbox, error) {
+	sandbox := buildSetSandbox(set, index, hash)
+	if err := controllerutil.SetControllerReference(set, sandbox, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, sandbox); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Created sandbox", "name", sandbox.Name)
+	r.Recorder.Eventf(set, corev1.EventTypeNormal, eventReasonCreated, "Created sandbox %s", sandbox.Name)
+	return sandbox, nil
+}
+
+// updateSetSandbox brings an existing sandbox up to date with the set's
+// template
+func (r *InspectSandboxSetReconciler) updateSetSandbox(
+	ctx context.Context,
+	set *inspectv1alpha1.InspectSandboxSet,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	index int,
+	hash string,
+) error {
+	desired := buildSetSandbox(set, index, hash)
+	sandbox.Spec = desired.Spec
+	if sandbox.Annotations == nil {
+		sandbox.Annotations = map[string]string{}
+	}
+	sandbox.Annotations[inspectv1alpha1.TemplateHashAnnotation] = hash
+	if err := r.Update(ctx, sandbox); err != nil {
+		if errors.IsConflict(err) {
+			// Retried when the watch sees the newer sandbox
+			return nil
+		}
+		return err
+	}
+	log.FromContext(ctx).Info("Updated sandbox to the current template", "name", sandbox.Name)
+	r.Recorder.Eventf(set, corev1.EventTypeNormal, eventReasonUpdated, "Updated sandbox %s", sandbox.Name)
+	return nil
+}
+
+// buildSetSandbox constructs the set's sandbox for index, telling each of
+// its services the index
+func buildSetSandbox(set *inspectv1alpha1.InspectSandboxSet, index int, hash string) *inspectv1alpha1.InspectSandbox {
+	spec := *set.Spec.Template.DeepCopy()
+	for svcName, svcSpec := range spec.Services {
+		svcSpec.Env = setEnvVar(svcSpec.Env, corev1.EnvVar{
+			Name:  inspectv1alpha1.SetIndexEnvVar,
+			Value: strconv.Itoa(index),
+		})
+		spec.Services[svcName] = svcSpec
+	}
+
+	return &inspectv1alpha1.InspectSandbox{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", set.Name, index),
+			Namespace: set.Namespace,
+			Labels: map[string]string{
+				inspectv1alpha1.SetLabel:      set.Name,
+				inspectv1alpha1.SetIndexLabel: strconv.Itoa(index),
+			},
+			Annotations: map[string]string{
+				inspectv1alpha1.TemplateHashAnnotation: hash,
+			},
+		},
+		Spec: spec,
+	}
+}
+
+// setEnvVar returns env with the variable of the same name replaced by
+// envVar, or envVar appended if there isn't one
+func setEnvVar(env []corev1.EnvVar, envVar corev1.EnvVar) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == envVar.Name {
+			env[i] = envVar
+			return env
+		}
+	}
+	return append(env, envVar)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *InspectSandboxSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&inspectv1alpha1.InspectSandboxSet{}).
+		Owns(&inspectv1alpha1.InspectSandbox{}).
+		Complete(r)
+}
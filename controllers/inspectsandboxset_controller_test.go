@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newSet returns a set called grid in the evals namespace
+func newSet(replicas int32) *inspectv1alpha1.InspectSandboxSet {
+	return &inspectv1alpha1.InspectSandboxSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "grid", Namespace: "evals", UID: "grid-uid", Generation: 1},
+		Spec: inspectv1alpha1.InspectSandboxSetSpec{
+			Replicas: replicas,
+			Template: inspectv1alpha1.InspectSandboxSpec{Services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu", Env: []corev1.EnvVar{{Name: "TASK", Value: "grid"}}},
+			}},
+		},
+	}
+}
+
+// setSandbox returns the set's sandbox for index, built from the template
+// with the given hash
+func setSandbox(
+	t *testing.T,
+	set *inspectv1alpha1.InspectSandboxSet,
+	index int,
+	hash string,
+	phase inspectv1alpha1.SandboxPhase,
+) *inspectv1alpha1.InspectSandbox {
+	t.Helper()
+	sandbox := buildSetSandbox(set, index, hash)
+	sandbox.UID = types.UID(sandbox.Name + "-uid")
+	sandbox.Status.Phase = phase
+	if err := controllerutil.SetControllerReference(set, sandbox, testScheme); err != nil {
+		t.Fatal(err)
+	}
+	return sandbox
+}
+
+func TestInspectSandboxSetReconcile(t *testing.T) {
+	hash, err := templateHash(&newSet(0).Spec.Template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		replicas    int32
+		status      inspectv1alpha1.InspectSandboxSetStatus
+		existing    func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object
+		want        []string
+		wantStatus  inspectv1alpha1.InspectSandboxSetStatus
+		wantReady   metav1.ConditionStatus
+		wantMessage string
+	}{
+		{
+			name:        "scales out",
+			replicas:    3,
+			want:        []string{"grid-0", "grid-1", "grid-2"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 3},
+			wantReady:   metav1.ConditionFalse,
+			wantMessage: "0 of 3 sandboxes are ready",
+		},
+		{
+			name:     "scales in from the highest index",
+			replicas: 1,
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				return []client.Object{
+					setSandbox(t, set, 0, hash, inspectv1alpha1.PhaseReady),
+					setSandbox(t, set, 1, hash, inspectv1alpha1.PhaseReady),
+					setSandbox(t, set, 2, hash, inspectv1alpha1.PhaseReady),
+				}
+			},
+			want:        []string{"grid-0"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 1, ReadyReplicas: 1},
+			wantReady:   metav1.ConditionTrue,
+			wantMessage: "1 of 1 sandboxes are ready",
+		},
+		{
+			name:     "updates sandboxes from an old template",
+			replicas: 2,
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				stale := setSandbox(t, set, 0, "stale", inspectv1alpha1.PhaseReady)
+				stale.Spec.Services["default"] = inspectv1alpha1.ServiceSpec{Image: "ubuntu:old"}
+				return []client.Object{stale, setSandbox(t, set, 1, hash, inspectv1alpha1.PhaseFailed)}
+			},
+			want:        []string{"grid-0", "grid-1"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 2, ReadyReplicas: 1, FailedReplicas: 1},
+			wantReady:   metav1.ConditionFalse,
+			wantMessage: "1 of 2 sandboxes are ready",
+		},
+		{
+			name:     "waits for a deleted sandbox to go before recreating it",
+			replicas: 2,
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				deleting := setSandbox(t, set, 1, hash, inspectv1alpha1.PhaseTerminating)
+				now := metav1.Now()
+				deleting.DeletionTimestamp = &now
+				deleting.Finalizers = []string{"test/keep"}
+				return []client.Object{setSandbox(t, set, 0, hash, inspectv1alpha1.PhaseReady), deleting}
+			},
+			want:        []string{"grid-0", "grid-1"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 1, ReadyReplicas: 1},
+			wantReady:   metav1.ConditionFalse,
+			wantMessage: "1 of 2 sandboxes are ready",
+		},
+		{
+			name:     "doesn't recreate an expired sandbox",
+			replicas: 3,
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				expired := setSandbox(t, set, 1, hash, inspectv1alpha1.PhaseTerminating)
+				meta.SetStatusCondition(&expired.Status.Conditions, metav1.Condition{
+					Type:   inspectv1alpha1.ConditionExpired,
+					Status: metav1.ConditionTrue,
+					Reason: "HeartbeatTimedOut",
+				})
+				now := metav1.Now()
+				expired.DeletionTimestamp = &now
+				expired.Finalizers = []string{"test/keep"}
+				return []client.Object{setSandbox(t, set, 0, hash, inspectv1alpha1.PhaseReady), expired}
+			},
+			want: []string{"grid-0", "grid-1", "grid-2"},
+			wantStatus: inspectv1alpha1.InspectSandboxSetStatus{
+				Replicas:         2,
+				ReadyReplicas:    1,
+				CompletedIndexes: []int32{1},
+			},
+			wantReady:   metav1.ConditionFalse,
+			wantMessage: "1 of 2 sandboxes are ready",
+		},
+		{
+			name:     "remembers completed indexes once their sandboxes have gone",
+			replicas: 2,
+			status:   inspectv1alpha1.InspectSandboxSetStatus{CompletedIndexes: []int32{1}},
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				return []client.Object{setSandbox(t, set, 0, hash, inspectv1alpha1.PhaseReady)}
+			},
+			want: []string{"grid-0"},
+			wantStatus: inspectv1alpha1.InspectSandboxSetStatus{
+				Replicas:         1,
+				ReadyReplicas:    1,
+				CompletedIndexes: []int32{1},
+			},
+			wantReady:   metav1.ConditionTrue,
+			wantMessage: "1 of 1 sandboxes are ready",
+		},
+		{
+			name:     "forgets completed indexes scaled in past",
+			replicas: 1,
+			status:   inspectv1alpha1.InspectSandboxSetStatus{CompletedIndexes: []int32{1}},
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				return []client.Object{setSandbox(t, set, 0, hash, inspectv1alpha1.PhaseReady)}
+			},
+			want:        []string{"grid-0"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 1, ReadyReplicas: 1},
+			wantReady:   metav1.ConditionTrue,
+			wantMessage: "1 of 1 sandboxes are ready",
+		},
+		{
+			name:     "ignores sandboxes it doesn't control",
+			replicas: 1,
+			existing: func(t *testing.T, set *inspectv1alpha1.InspectSandboxSet) []client.Object {
+				other := setSandbox(t, set, 5, hash, inspectv1alpha1.PhaseReady)
+				other.OwnerReferences = nil
+				return []client.Object{other}
+			},
+			want:        []string{"grid-0", "grid-5"},
+			wantStatus:  inspectv1alpha1.InspectSandboxSetStatus{Replicas: 1},
+			wantReady:   metav1.ConditionFalse,
+			wantMessage: "0 of 1 sandboxes are ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := newSet(tt.replicas)
+			set.Status = tt.status
+			objs := []client.Object{set}
+			if tt.existing != nil {
+				objs = append(objs, tt.existing(t, set)...)
+			}
+			c := newFakeClient(objs...)
+			r := &InspectSandboxSetReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(set)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var sandboxes inspectv1alpha1.InspectSandboxList
+			if err := c.List(context.Background(), &sandboxes); err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, sandbox := range sandboxes.Items {
+				names = append(names, sandbox.Name)
+				if !metav1.IsControlledBy(&sandbox, set) || !sandbox.DeletionTimestamp.IsZero() {
+					continue
+				}
+				index := sandbox.Labels[inspectv1alpha1.SetIndexLabel]
+				if sandbox.Annotations[inspectv1alpha1.TemplateHashAnnotation] != hash {
+					t.Errorf("%s wasn't updated to the current template", sandbox.Name)
+				}
+				wantEnv := []corev1.EnvVar{
+					{Name: "TASK", Value: "grid"},
+					{Name: inspectv1alpha1.SetIndexEnvVar, Value: index},
+				}
+				if got := sandbox.Spec.Services["default"]; got.Image != "ubuntu" || !reflect.DeepEqual(got.Env, wantEnv) {
+					t.Errorf("%s default service = %+v, want ubuntu with env %v", sandbox.Name, got, wantEnv)
+				}
+				if sandbox.Name != "grid-"+index {
+					t.Errorf("%s has index label %s", sandbox.Name, index)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("sandboxes = %v, want %v", names, tt.want)
+			}
+
+			var got inspectv1alpha1.InspectSandboxSet
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(set), &got); err != nil {
+				t.Fatal(err)
+			}
+			ready := meta.FindStatusCondition(got.Status.Conditions, inspectv1alpha1.ConditionReady)
+			got.Status.Conditions = nil
+			tt.wantStatus.ObservedGeneration = 1
+			if !reflect.DeepEqual(got.Status, tt.wantStatus) {
+				t.Errorf("status = %+v, want %+v", got.Status, tt.wantStatus)
+			}
+			if ready == nil || ready.Status != tt.wantReady || ready.Message != tt.wantMessage {
+				t.Errorf("Ready = %+v, want %s %q", ready, tt.wantReady, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestBuildSetSandboxIndex(t *testing.T) {
+	set := newSet(1)
+	// A template that sets the index itself has it overwritten
+	svc := set.Spec.Template.Services["default"]
+	svc.Env = append(svc.Env, corev1.EnvVar{Name: inspectv1alpha1.SetIndexEnvVar, Value: "99"})
+	set.Spec.Template.Services["default"] = svc
+	set.Spec.Template.Services["db"] = inspectv1alpha1.ServiceSpec{Image: "postgres"}
+
+	for index := 0; index < 3; index++ {
+		sandbox := buildSetSandbox(set, index, "hash")
+		want := strconv.Itoa(index)
+		for svcName, svcSpec := range sandbox.Spec.Services {
+			var values []string
+			for _, env := range svcSpec.Env {
+				if env.Name == inspectv1alpha1.SetIndexEnvVar {
+					values = append(values, env.Value)
+				}
+			}
+			if !reflect.DeepEqual(values, []string{want}) {
+				t.Errorf("index %d: %s has %s=%v, want %s", index, svcName, inspectv1alpha1.SetIndexEnvVar, values, want)
+			}
+		}
+	}
+
+	// Building a sandbox must leave the set's template alone
+	if got := set.Spec.Template.Services["default"].Env[1].Value; got != "99" {
+		t.Errorf("template index variable changed to %s", got)
+	}
+}
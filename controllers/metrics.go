@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// metricsNamespace prefixes every metric the operator exports
+const metricsNamespace = "inspect_sandbox"
+
+var (
+	// timeToReady tracks how long sandboxes take to first become ready
+	timeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "time_to_ready_seconds",
+		Help:      "Time from sandbox creation until every service is first ready.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"namespace"})
+
+	// serviceTimeToReady tracks how long each service takes to first become ready
+	serviceTimeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "service_time_to_ready_seconds",
+		Help:      "Time from sandbox creation until a service is first ready.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"namespace", "service"})
+
+	// childObjectOperations counts writes to child objects
+	childObjectOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "child_object_operations_total",
+		Help:      "Child objects created, updated or deleted by the operator.",
+	}, []string{"kind", "operation"})
+
+	// networkPolicyFailures counts reconciles that failed to apply policies
+	networkPolicyFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "network_policy_failures_total",
+		Help:      "Reconciles that failed to apply a sandbox's network policies.",
+	}, []string{"namespace", "backend"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		timeToReady,
+		serviceTimeToReady,
+		childObjectOperations,
+		networkPolicyFailures,
+	)
+}
+
+// sandboxPhases lists every phase so each is reported even when empty
+var sandboxPhases = []inspectv1alpha1.SandboxPhase{
+	inspectv1alpha1.PhasePending,
+	inspectv1alpha1.PhaseProvisioning,
+	inspectv1alpha1.PhaseReady,
+	inspectv1alpha1.PhaseDegraded,
+	inspectv1alpha1.PhaseTerminating,
+	inspectv1alpha1.PhaseFailed,
+	inspectv1alpha1.PhaseSuspended,
+}
+
+// sandboxCollector reports gauges computed from the cached sandboxes at
+// scrape time, so deleted sandboxes don't leave stale series behind
+type sandboxCollector struct {
+	client client.Reader
+
+	phase    *prometheus.Desc
+	restarts *prometheus.Desc
+}
+
+// newSandboxCollector returns a collector reading sandboxes through c
+func newSandboxCollector(c client.Reader) *sandboxCollector {
+	return &sandboxCollector{
+		client: c,
+		phase: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "sandboxes"),
+			"Number of sandboxes in each phase.",
+			[]string{"namespace", "phase"}, nil,
+		),
+		restarts: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "pod_restarts"),
+			"Container restarts across the pods of a sandbox.",
+			[]string{"namespace", "sandbox"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *sandboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.phase
+	ch <- c.restarts
+}
+
+// Collect implements prometheus.Collector
+func (c *sandboxCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := c.client.List(ctx, &sandboxes); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.phase, err)
+		return
+	}
+
+	counts := make(map[string]map[inspectv1alpha1.SandboxPhase]int)
+	for _, sandbox := range sandboxes.Items {
+		if counts[sandbox.Namespace] == nil {
+			counts[sandbox.Namespace] = make(map[inspectv1alpha1.SandboxPhase]int)
+		}
+		phase := sandbox.Status.Phase
+		if phase == "" {
+			phase = inspectv1alpha1.PhasePending
+		}
+		counts[sandbox.Namespace][phase]++
+
+		var restarts int32
+		for _, svcStatus := range sandbox.Status.Services {
+			restarts += svcStatus.RestartCount
+		}
+		ch <- prometheus.MustNewConstMetric(c.restarts, prometheus.GaugeValue,
+			float64(restarts), sandbox.Namespace, sandbox.Name)
+	}
+
+	for namespace, phases := range counts {
+		for _, phase := range sandboxPhases {
+			ch <- prometheus.MustNewConstMetric(c.phase, prometheus.GaugeValue,
+				float64(phases[phase]), namespace, string(phase))
+		}
+	}
+}
+
+// sinceCreation returns the seconds since the sandbox was created
+func sinceCreation(sandbox *inspectv1alpha1.InspectSandbox) float64 {
+	return time.Since(sandbox.CreationTimestamp.Time).Seconds()
+}
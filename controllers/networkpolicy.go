@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// NetworkPolicyBackend is the API used to isolate sandboxes
+type NetworkPolicyBackend string
+
+const (
+	// NetworkPolicyBackendCilium uses CiliumNetworkPolicies, which support
+	// allow-listing egress by domain name
+	NetworkPolicyBackendCilium NetworkPolicyBackend = "cilium"
+
+	// NetworkPolicyBackendKubernetes uses networking.k8s.io NetworkPolicies,
+	// which work with any policy-enforcing CNI but can't match domain names
+	NetworkPolicyBackendKubernetes NetworkPolicyBackend = "kubernetes"
+)
+
+// DetectNetworkPolicyBackend returns the Cilium backend if the cluster
+// serves CiliumNetworkPolicies, and the Kubernetes backend otherwise
+func DetectNetworkPolicyBackend(config *rest.Config) (NetworkPolicyBackend, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(ciliumv2.GroupVersion.String())
+	if errors.IsNotFound(err) {
+		return NetworkPolicyBackendKubernetes, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("discovering %s: %w", ciliumv2.GroupVersion, err)
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == "CiliumNetworkPolicy" {
+			return NetworkPolicyBackendCilium, nil
+		}
+	}
+	return NetworkPolicyBackendKubernetes, nil
+}
+
+// networkPolicyBackend returns the configured backend, defaulting to Cilium
+func (r *InspectSandboxReconciler) networkPolicyBackend() NetworkPolicyBackend {
+	if r.NetworkPolicyBackend == "" {
+		return NetworkPolicyBackendCilium
+	}
+	return r.NetworkPolicyBackend
+}
+
+// buildNetworkPolicies constructs every network policy the sandbox needs
+// with the given backend. The Kubernetes ones are equivalent to the Cilium
+// ones, minus the domain allow-list.
+func buildNetworkPolicies(sandbox *inspectv1alpha1.InspectSandbox, backend NetworkPolicyBackend) []client.Object {
+	networkNames := make([]string, 0, len(sandbox.Spec.Networks))
+	for networkName := range sandbox.Spec.Networks {
+		networkNames = append(networkNames, networkName)
+	}
+	sort.Strings(networkNames)
+
+	if backend == NetworkPolicyBackendKubernetes {
+		egress := buildKubeEgressPolicy(sandbox)
+		defaultDeny := buildKubeDefaultDenyIngressPolicy(sandbox)
+		policies := []client.Object{&egress, &defaultDeny}
+		for _, networkName := range networkNames {
+			policy := buildKubeNetworkIngressPolicy(sandbox, networkName)
+			policies = append(policies, &policy)
+		}
+		return policies
+	}
+
+	// Egress for allowed domains, then deny all ingress by default and
+	// allow it within each network
+	egress := buildSandboxEgressPolicy(sandbox)
+	defaultDeny := buildDefaultDenyIngressPolicy(sandbox)
+	policies := []client.Object{&egress, &defaultDeny}
+	for _, networkName := range networkNames {
+		policy := buildNetworkIngressPolicy(sandbox, networkName)
+		policies = append(policies, &policy)
+	}
+	return policies
+}
+
+// buildKubeEgressPolicy constructs an egress policy allowing DNS lookups and
+// traffic within the sandbox. Domains can't be allowed without Cilium.
+func buildKubeEgressPolicy(sandbox *inspectv1alpha1.InspectSandbox) networkingv1.NetworkPolicy {
+	dnsPort := intstr.FromInt32(53)
+
+	return networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-egress", sandbox.Name),
+			Namespace: sandbox.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "inspectsandbox",
+				"app.kubernetes.io/instance":   sandbox.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/instance": sandbox.Name,
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				// Allow DNS lookups
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"kubernetes.io/metadata.name": "kube-system",
+								},
+							},
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"k8s-app": "kube-dns",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: pointer(corev1.ProtocolUDP), Port: &dnsPort},
+						{Protocol: pointer(corev1.ProtocolTCP), Port: &dnsPort},
+					},
+				},
+				// Allow communication within the sandbox
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app.kubernetes.io/instance": sandbox.Name,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildKubeDefaultDenyIngressPolicy constructs a policy denying all ingress
+// to the sandbox's pods
+func buildKubeDefaultDenyIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox) networkingv1.NetworkPolicy {
+	return networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-default-deny-ingress", sandbox.Name),
+			Namespace: sandbox.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "inspectsandbox",
+				"app.kubernetes.io/instance":   sandbox.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/instance": sandbox.Name,
+				},
+			},
+			// No ingress rules, so nothing is allowed in
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+}
+
+// buildKubeNetworkIngressPolicy constructs a policy allowing ingress between
+// pods on the same network
+func buildKubeNetworkIngressPolicy(sandbox *inspectv1alpha1.InspectSandbox, networkName string) networkingv1.NetworkPolicy {
+	networkLabel := fmt.Sprintf("inspect.example.com/network-%s", networkName)
+
+	return networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-network-%s-ingress", sandbox.Name, networkName),
+			Namespace: sandbox.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "inspectsandbox",
+				"app.kubernetes.io/instance":   sandbox.Name,
+				"app.kubernetes.io/managed-by": "inspect-operator",
+				"inspect.example.com/network":  networkName,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/instance": sandbox.Name,
+					networkLabel:                 "true",
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app.kubernetes.io/instance": sandbox.Name,
+									networkLabel:                 "true",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// setDomainAllowListCondition reports whether the sandbox's allowDomains
+// are enforced. The condition is only present when domains are listed.
+func (r *InspectSandboxReconciler) setDomainAllowListCondition(sandbox *inspectv1alpha1.InspectSandbox) {
+	if len(sandbox.Spec.AllowDomains) == 0 {
+		meta.RemoveStatusCondition(&sandbox.Status.Conditions, inspectv1alpha1.ConditionDomainAllowList)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionDomainAllowList,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "FQDNPolicyApplied",
+		Message:            "Egress to allowDomains is permitted by a Cilium FQDN policy",
+	}
+	if r.networkPolicyBackend() != NetworkPolicyBackendCilium {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "FQDNPolicyUnavailable"
+		condition.Message = "Cilium is not installed, so allowDomains can't be enforced and egress to them is blocked"
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, condition)
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newPolicySandbox returns a sandbox with the given allowed domains and
+// networks
+func newPolicySandbox(allowDomains []string, networks ...string) *inspectv1alpha1.InspectSandbox {
+	sandbox := &inspectv1alpha1.InspectSandbox{
+		ObjectMeta: metav1.ObjectMeta{Name: "task", Namespace: "evals"},
+		Spec: inspectv1alpha1.InspectSandboxSpec{
+			AllowDomains: allowDomains,
+			Networks:     map[string]string{},
+		},
+	}
+	for _, network := range networks {
+		sandbox.Spec.Networks[network] = network
+	}
+	return sandbox
+}
+
+func TestBuildSandboxEgressPolicy(t *testing.T) {
+	kubeDNSRule := ciliumv2.EgressRule{
+		ToEndpoints: []ciliumv2.EndpointSelector{{
+			MatchLabels: map[string]string{
+				"io.kubernetes.pod.namespace": "kube-system",
+				"k8s-app":                     "kube-dns",
+			},
+		}},
+		ToPorts: []ciliumv2.PortRule{{
+			Ports: []ciliumv2.PortProtocol{
+				{Port: "53", Protocol: ciliumv2.ProtoUDP},
+				{Port: "53", Protocol: ciliumv2.ProtoTCP},
+			},
+			Rules: &ciliumv2.L7Rules{DNS: []ciliumv2.PortRuleDNS{{MatchPattern: "*"}}},
+		}},
+	}
+	sandboxRule := ciliumv2.EgressRule{
+		ToEndpoints: []ciliumv2.EndpointSelector{{
+			MatchLabels: map[string]string{"app.kubernetes.io/instance": "task"},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		allowDomains []string
+		want         []ciliumv2.EgressRule
+	}{
+		{
+			name: "no allowed domains",
+			want: []ciliumv2.EgressRule{kubeDNSRule, sandboxRule},
+		},
+		{
+			name:         "allowed domains and their subdomains",
+			allowDomains: []string{"pypi.org", "example.com"},
+			want: []ciliumv2.EgressRule{kubeDNSRule, sandboxRule, {
+				ToFQDNs: []ciliumv2.FQDNSelector{
+					{MatchName: "pypi.org"},
+					{MatchPattern: "*.pypi.org"},
+					{MatchName: "example.com"},
+					{MatchPattern: "*.example.com"},
+				},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := buildSandboxEgressPolicy(newPolicySandbox(tt.allowDomains))
+
+			if policy.Name != "task-egress" || policy.Namespace != "evals" {
+				t.Errorf("got policy %s/%s, want evals/task-egress", policy.Namespace, policy.Name)
+			}
+			wantSelector := ciliumv2.EndpointSelector{
+				MatchLabels: map[string]string{"app.kubernetes.io/instance": "task"},
+			}
+			if !reflect.DeepEqual(policy.Spec.EndpointSelector, wantSelector) {
+				t.Errorf("endpointSelector = %+v, want %+v", policy.Spec.EndpointSelector, wantSelector)
+			}
+			if !reflect.DeepEqual(policy.Spec.Egress, tt.want) {
+				t.Errorf("egress = %+v, want %+v", policy.Spec.Egress, tt.want)
+			}
+			if policy.Spec.Ingress != nil {
+				t.Errorf("egress policy has ingress rules %+v", policy.Spec.Ingress)
+			}
+		})
+	}
+}
+
+func TestBuildDefaultDenyIngressPolicy(t *testing.T) {
+	policy := buildDefaultDenyIngressPolicy(newPolicySandbox(nil))
+
+	if policy.Name != "task-default-deny-ingress" {
+		t.Errorf("name = %s, want task-default-deny-ingress", policy.Name)
+	}
+	// An empty list would be dropped from the JSON and allow all ingress
+	want := []ciliumv2.IngressRule{{}}
+	if !reflect.DeepEqual(policy.Spec.Ingress, want) {
+		t.Errorf("ingress = %+v, want a single empty rule", policy.Spec.Ingress)
+	}
+	data, err := json.Marshal(policy.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `{"endpointSelector":{"matchLabels":{"app.kubernetes.io/instance":"task"}},"ingress":[{}]}` {
+		t.Errorf("spec JSON = %s", got)
+	}
+}
+
+func TestBuildNetworkIngressPolicy(t *testing.T) {
+	tests := []struct {
+		network  string
+		wantName string
+		wantKey  string
+	}{
+		{network: "default", wantName: "task-network-default-ingress", wantKey: "inspect.example.com/network-default"},
+		{network: "db", wantName: "task-network-db-ingress", wantKey: "inspect.example.com/network-db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			policy := buildNetworkIngressPolicy(newPolicySandbox(nil, tt.network), tt.network)
+
+			if policy.Name != tt.wantName {
+				t.Errorf("name = %s, want %s", policy.Name, tt.wantName)
+			}
+			if got := policy.Labels["inspect.example.com/network"]; got != tt.network {
+				t.Errorf("network label = %q, want %q", got, tt.network)
+			}
+			members := ciliumv2.EndpointSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/instance": "task",
+					tt.wantKey:                   "true",
+				},
+			}
+			if !reflect.DeepEqual(policy.Spec.EndpointSelector, members) {
+				t.Errorf("endpointSelector = %+v, want %+v", policy.Spec.EndpointSelector, members)
+			}
+			want := []ciliumv2.IngressRule{{FromEndpoints: []ciliumv2.EndpointSelector{members}}}
+			if !reflect.DeepEqual(policy.Spec.Ingress, want) {
+				t.Errorf("ingress = %+v, want %+v", policy.Spec.Ingress, want)
+			}
+		})
+	}
+}
+
+func TestBuildNetworkPolicies(t *testing.T) {
+	sandbox := newPolicySandbox([]string{"pypi.org"}, "web", "db")
+
+	tests := []struct {
+		backend NetworkPolicyBackend
+		want    []string
+	}{
+		{
+			backend: NetworkPolicyBackendCilium,
+			want:    []string{"task-egress", "task-default-deny-ingress", "task-network-db-ingress", "task-network-web-ingress"},
+		},
+		{
+			backend: NetworkPolicyBackendKubernetes,
+			want:    []string{"task-egress", "task-default-deny-ingress", "task-network-db-ingress", "task-network-web-ingress"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.backend), func(t *testing.T) {
+			var names []string
+			for _, policy := range buildNetworkPolicies(sandbox, tt.backend) {
+				names = append(names, policy.GetName())
+				switch policy.(type) {
+				case *ciliumv2.CiliumNetworkPolicy:
+					if tt.backend != NetworkPolicyBackendCilium {
+						t.Errorf("%s is a CiliumNetworkPolicy", policy.GetName())
+					}
+				case *networkingv1.NetworkPolicy:
+					if tt.backend != NetworkPolicyBackendKubernetes {
+						t.Errorf("%s is a NetworkPolicy", policy.GetName())
+					}
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("policies = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildKubeEgressPolicy(t *testing.T) {
+	policy := buildKubeEgressPolicy(newPolicySandbox([]string{"pypi.org"}))
+
+	if !reflect.DeepEqual(policy.Spec.PolicyTypes, []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}) {
+		t.Errorf("policyTypes = %v, want Egress", policy.Spec.PolicyTypes)
+	}
+	if len(policy.Spec.Egress) != 2 {
+		t.Fatalf("got %d egress rules, want DNS and intra-sandbox only", len(policy.Spec.Egress))
+	}
+
+	dns := policy.Spec.Egress[0]
+	if len(dns.To) != 1 || dns.To[0].PodSelector.MatchLabels["k8s-app"] != "kube-dns" ||
+		dns.To[0].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "kube-system" {
+		t.Errorf("first rule doesn't select kube-dns: %+v", dns.To)
+	}
+	var protocols []corev1.Protocol
+	for _, port := range dns.Ports {
+		if port.Port.IntValue() != 53 {
+			t.Errorf("DNS rule allows port %s", port.Port)
+		}
+		protocols = append(protocols, *port.Protocol)
+	}
+	if !reflect.DeepEqual(protocols, []corev1.Protocol{corev1.ProtocolUDP, corev1.ProtocolTCP}) {
+		t.Errorf("DNS protocols = %v, want UDP and TCP", protocols)
+	}
+
+	intra := policy.Spec.Egress[1]
+	if len(intra.To) != 1 || intra.To[0].PodSelector.MatchLabels["app.kubernetes.io/instance"] != "task" ||
+		intra.To[0].NamespaceSelector != nil || intra.Ports != nil {
+		t.Errorf("second rule doesn't allow all traffic within the sandbox: %+v", intra)
+	}
+}
+
+func TestBuildKubeIngressPolicies(t *testing.T) {
+	sandbox := newPolicySandbox(nil, "db")
+
+	deny := buildKubeDefaultDenyIngressPolicy(sandbox)
+	if deny.Spec.Ingress != nil ||
+		!reflect.DeepEqual(deny.Spec.PolicyTypes, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}) {
+		t.Errorf("default deny policy allows ingress: %+v", deny.Spec)
+	}
+
+	network := buildKubeNetworkIngressPolicy(sandbox, "db")
+	members := map[string]string{
+		"app.kubernetes.io/instance":     "task",
+		"inspect.example.com/network-db": "true",
+	}
+	if !reflect.DeepEqual(network.Spec.PodSelector.MatchLabels, members) {
+		t.Errorf("podSelector = %v, want %v", network.Spec.PodSelector.MatchLabels, members)
+	}
+	if len(network.Spec.Ingress) != 1 || len(network.Spec.Ingress[0].From) != 1 ||
+		!reflect.DeepEqual(network.Spec.Ingress[0].From[0].PodSelector.MatchLabels, members) {
+		t.Errorf("ingress = %+v, want only from members of the network", network.Spec.Ingress)
+	}
+}
+
+// TestCiliumPolicyUnchanged checks that a policy read back from the API
+// server compares equal to a freshly built one, so applying it again is a
+// no-op rather than an update every reconcile
+func TestCiliumPolicyUnchanged(t *testing.T) {
+	sandbox := newPolicySandbox([]string{"pypi.org"}, "default")
+
+	for _, desired := range buildNetworkPolicies(sandbox, NetworkPolicyBackendCilium) {
+		t.Run(desired.GetName(), func(t *testing.T) {
+			data, err := json.Marshal(desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var live ciliumv2.CiliumNetworkPolicy
+			if err := json.Unmarshal(data, &live); err != nil {
+				t.Fatal(err)
+			}
+
+			rebuilt := buildNetworkPolicies(sandbox, NetworkPolicyBackendCilium)
+			var again *ciliumv2.CiliumNetworkPolicy
+			for _, policy := range rebuilt {
+				if policy.GetName() == desired.GetName() {
+					again = policy.(*ciliumv2.CiliumNetworkPolicy)
+				}
+			}
+			if !equality.Semantic.DeepEqual(&live, again) {
+				t.Errorf("policy read back differs from the rebuilt one:\n%+v\n%+v", live, *again)
+			}
+
+			// Copies must not share rules with the original, which the
+			// informer cache relies on
+			copied := live.DeepCopy()
+			if len(copied.Spec.Egress) > 0 {
+				copied.Spec.Egress[0].ToEndpoints[0].MatchLabels["changed"] = "true"
+			}
+			if len(copied.Spec.Ingress) > 0 {
+				copied.Spec.Ingress[0].FromEndpoints = append(copied.Spec.Ingress[0].FromEndpoints,
+					ciliumv2.EndpointSelector{})
+			}
+			if !equality.Semantic.DeepEqual(&live, again) {
+				t.Errorf("changing a deep copy changed the original")
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// pruneResources deletes child objects for services, volumes and networks
+// that are no longer in the sandbox spec, and drops their status entries
+func (r *InspectSandboxReconciler) pruneResources(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) error {
+	logger := log.FromContext(ctx)
+
+	// Work out the names of every object the current spec wants
+	services := sets.New[string]()
+	for svcName := range sandbox.Spec.Services {
+		services.Insert(fmt.Sprintf("%s-%s", sandbox.Name, svcName))
+	}
+	volumes := sets.New[string]()
+	for volName := range sandbox.Spec.Volumes {
+		volumes.Insert(fmt.Sprintf("%s-%s", sandbox.Name, volName))
+	}
+	policies := sets.New(
+		fmt.Sprintf("%s-egress", sandbox.Name),
+		fmt.Sprintf("%s-default-deny-ingress", sandbox.Name),
+	)
+	for networkName := range sandbox.Spec.Networks {
+		policies.Insert(fmt.Sprintf("%s-network-%s-ingress", sandbox.Name, networkName))
+	}
+
+	configMaps := sets.New[string]()
+	if sandboxUsesDNSResolver(sandbox) {
+		configMaps.Insert(fmt.Sprintf("%s-dns", sandbox.Name))
+	}
+
+	// Remove workloads before the policies that isolate them
+	var statefulSets appsv1.StatefulSetList
+	if err := r.List(ctx, &statefulSets, sandboxListOptions(sandbox)...); err != nil {
+		return err
+	}
+	for i := range statefulSets.Items {
+		if err := r.pruneObject(ctx, sandbox, &statefulSets.Items[i], services); err != nil {
+			return err
+		}
+	}
+
+	var kubeServices corev1.ServiceList
+	if err := r.List(ctx, &kubeServices, sandboxListOptions(sandbox)...); err != nil {
+		return err
+	}
+	for i := range kubeServices.Items {
+		if err := r.pruneObject(ctx, sandbox, &kubeServices.Items[i], services); err != nil {
+			return err
+		}
+	}
+
+	var kubeConfigMaps corev1.ConfigMapList
+	if err := r.List(ctx, &kubeConfigMaps, sandboxListOptions(sandbox)...); err != nil {
+		return err
+	}
+	for i := range kubeConfigMaps.Items {
+		if err := r.pruneObject(ctx, sandbox, &kubeConfigMaps.Items[i], configMaps); err != nil {
+			return err
+		}
+	}
+
+	var claims corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &claims, sandboxListOptions(sandbox)...); err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		pvc := &claims.Items[i]
+		if volumes.Has(pvc.Name) {
+			continue
+		}
+		logger.Info("Pruning volume claim", "name", pvc.Name)
+		if err := r.releaseVolumeClaim(ctx, sandbox, pvc); err != nil {
+			return err
+		}
+	}
+
+	// Policies of the backend not in use are all stale, e.g. after Cilium
+	// is installed into a cluster that didn't have it
+	ciliumPolicyNames, kubePolicyNames := policies, sets.New[string]()
+	if r.networkPolicyBackend() == NetworkPolicyBackendKubernetes {
+		ciliumPolicyNames, kubePolicyNames = kubePolicyNames, ciliumPolicyNames
+	}
+
+	var ciliumPolicies ciliumv2.CiliumNetworkPolicyList
+	if err := r.List(ctx, &ciliumPolicies, sandboxListOptions(sandbox)...); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+	}
+	for i := range ciliumPolicies.Items {
+		if err := r.pruneObject(ctx, sandbox, &ciliumPolicies.Items[i], ciliumPolicyNames); err != nil {
+			return err
+		}
+	}
+
+	var kubePolicies networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &kubePolicies, sandboxListOptions(sandbox)...); err != nil {
+		return err
+	}
+	for i := range kubePolicies.Items {
+		if err := r.pruneObject(ctx, sandbox, &kubePolicies.Items[i], kubePolicyNames); err != nil {
+			return err
+		}
+	}
+
+	// Forget the status of services that are gone
+	for svcName := range sandbox.Status.Services {
+		if _, ok := sandbox.Spec.Services[svcName]; !ok {
+			delete(sandbox.Status.Services, svcName)
+		}
+	}
+
+	return nil
+}
+
+// pruneObject deletes obj unless its name is in desired
+func (r *InspectSandboxReconciler) pruneObject(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	obj client.Object,
+	desired sets.Set[string],
+) error {
+	if desired.Has(obj.GetName()) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Pruning object no longer in spec",
+		"kind", fmt.Sprintf("%T", obj), "name", obj.GetName())
+	return r.deleteOwned(ctx, sandbox, obj)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// newPruneSandbox returns a sandbox with a default service on the internal
+// network and a data volume
+func newPruneSandbox() *inspectv1alpha1.InspectSandbox {
+	sandbox := newDNSSandbox(map[string]inspectv1alpha1.ServiceSpec{
+		"default": {Image: "ubuntu", Networks: []string{"internal"}, Volumes: []string{"data:/data"}},
+	})
+	sandbox.UID = "task-uid"
+	sandbox.Spec.Networks = map[string]string{"internal": ""}
+	sandbox.Spec.Volumes = map[string]inspectv1alpha1.VolumeSpec{"data": {}}
+	sandbox.Status.Services = map[string]inspectv1alpha1.ServiceStatus{
+		"default": {Ready: true},
+		"old":     {Ready: true},
+	}
+	return sandbox
+}
+
+// sandboxChild labels obj as belonging to the sandbox and, if controlled,
+// makes the sandbox its controller
+func sandboxChild(t *testing.T, sandbox *inspectv1alpha1.InspectSandbox, obj client.Object, name string, controlled bool) client.Object {
+	t.Helper()
+	obj.SetName(name)
+	obj.SetNamespace(sandbox.Namespace)
+	obj.SetLabels(map[string]string{
+		"app.kubernetes.io/instance":   sandbox.Name,
+		"app.kubernetes.io/managed-by": "inspect-operator",
+	})
+	if controlled {
+		if err := controllerutil.SetControllerReference(sandbox, obj, testScheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return obj
+}
+
+// listNames returns the sorted names of the objects of list's kind
+func listNames(t *testing.T, c client.Client, list client.ObjectList) []string {
+	t.Helper()
+	if err := c.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.(client.Object).GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPruneResources(t *testing.T) {
+	tests := []struct {
+		backend            NetworkPolicyBackend
+		wantCiliumPolicies []string
+		wantKubePolicies   []string
+	}{
+		{
+			backend:            NetworkPolicyBackendCilium,
+			wantCiliumPolicies: []string{"task-default-deny-ingress", "task-egress", "task-network-internal-ingress"},
+			wantKubePolicies:   []string{},
+		},
+		{
+			backend:            NetworkPolicyBackendKubernetes,
+			wantCiliumPolicies: []string{},
+			wantKubePolicies:   []string{"task-default-deny-ingress", "task-egress", "task-network-internal-ingress"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.backend), func(t *testing.T) {
+			sandbox := newPruneSandbox()
+			var objs []client.Object
+			for _, name := range []string{"task-default", "task-old"} {
+				objs = append(objs,
+					sandboxChild(t, sandbox, &appsv1.StatefulSet{}, name, true),
+					sandboxChild(t, sandbox, &corev1.Service{}, name, true))
+			}
+			// Objects the sandbox doesn't control are never pruned
+			objs = append(objs, sandboxChild(t, sandbox, &appsv1.StatefulSet{}, "task-adopted", false))
+			objs = append(objs,
+				sandboxChild(t, sandbox, &corev1.PersistentVolumeClaim{}, "task-data", true),
+				sandboxChild(t, sandbox, &corev1.PersistentVolumeClaim{}, "task-scratch", true))
+			for _, name := range []string{"task-egress", "task-default-deny-ingress", "task-network-internal-ingress", "task-network-old-ingress"} {
+				objs = append(objs,
+					sandboxChild(t, sandbox, &ciliumv2.CiliumNetworkPolicy{}, name, true),
+					sandboxChild(t, sandbox, &networkingv1.NetworkPolicy{}, name, true))
+			}
+			c := newFakeClient(objs...)
+			r := &InspectSandboxReconciler{
+				Client:               c,
+				Scheme:               testScheme,
+				NetworkPolicyBackend: tt.backend,
+				Recorder:             record.NewFakeRecorder(100),
+			}
+
+			if err := r.pruneResources(context.Background(), sandbox); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got, want := listNames(t, c, &appsv1.StatefulSetList{}), []string{"task-adopted", "task-default"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("StatefulSets = %v, want %v", got, want)
+			}
+			if got, want := listNames(t, c, &corev1.ServiceList{}), []string{"task-default"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Services = %v, want %v", got, want)
+			}
+			if got, want := listNames(t, c, &corev1.PersistentVolumeClaimList{}), []string{"task-data"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("PersistentVolumeClaims = %v, want %v", got, want)
+			}
+			if got := listNames(t, c, &ciliumv2.CiliumNetworkPolicyList{}); !reflect.DeepEqual(got, tt.wantCiliumPolicies) {
+				t.Errorf("CiliumNetworkPolicies = %v, want %v", got, tt.wantCiliumPolicies)
+			}
+			if got := listNames(t, c, &networkingv1.NetworkPolicyList{}); !reflect.DeepEqual(got, tt.wantKubePolicies) {
+				t.Errorf("NetworkPolicies = %v, want %v", got, tt.wantKubePolicies)
+			}
+			if _, ok := sandbox.Status.Services["old"]; ok {
+				t.Error("status still reports the removed service")
+			}
+		})
+	}
+}
+
+func TestPruneResourcesRetainsVolumes(t *testing.T) {
+	sandbox := newPruneSandbox()
+	sandbox.Spec.VolumeRetentionPolicy = inspectv1alpha1.VolumeRetentionRetain
+	c := newFakeClient(
+		sandboxChild(t, sandbox, &corev1.PersistentVolumeClaim{}, "task-data", true),
+		sandboxChild(t, sandbox, &corev1.PersistentVolumeClaim{}, "task-scratch", true),
+	)
+	r := &InspectSandboxReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+	if err := r.pruneResources(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := listNames(t, c, &corev1.PersistentVolumeClaimList{}), []string{"task-data", "task-scratch"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("PersistentVolumeClaims = %v, want %v", got, want)
+	}
+	for name, wantControlled := range map[string]bool{"task-data": true, "task-scratch": false} {
+		var pvc corev1.PersistentVolumeClaim
+		if err := c.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "evals"}, &pvc); err != nil {
+			t.Fatal(err)
+		}
+		if got := metav1.IsControlledBy(&pvc, sandbox); got != wantControlled {
+			t.Errorf("%s controlled by the sandbox = %v, want %v", name, got, wantControlled)
+		}
+	}
+}
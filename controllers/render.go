@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// RenderOptions are the operator settings that child objects depend on
+type RenderOptions struct {
+	// ClusterDomain is the cluster's DNS domain, defaulting to cluster.local
+	ClusterDomain string
+
+	// ClusterDNS is the address the sandbox DNS resolver forwards queries
+	// to. The operator looks it up from kube-dns, so it must be given here
+	// when any service publishes a DNS name.
+	ClusterDNS string
+
+	// NetworkPolicyBackend selects the kind of network policies rendered,
+	// defaulting to Cilium
+	NetworkPolicyBackend NetworkPolicyBackend
+
+	// Templates are the InspectSandboxTemplates a templateRef may name. A
+	// sandbox with a template snapshot in its status is built from the
+	// snapshot instead, as the operator does, unless it rolls out template
+	// changes or the snapshot is of another template.
+	Templates []inspectv1alpha1.InspectSandboxTemplate
+
+	// Defaulter fills in the operator's defaults on sandboxes built from a
+	// template, as the reconciler does
+	Defaulter *inspectv1alpha1.InspectSandboxDefaulter
+}
+
+// SandboxSpec returns the spec the operator builds sandbox's child objects
+// from: its template merged with its overrides and defaulted, or its own
+// spec if it has no template
+func SandboxSpec(sandbox *inspectv1alpha1.InspectSandbox, opts RenderOptions) (inspectv1alpha1.InspectSandboxSpec, error) {
+	ref := sandbox.Spec.TemplateRef
+	if ref == nil {
+		return *sandbox.Spec.DeepCopy(), nil
+	}
+
+	var template *inspectv1alpha1.InspectSandboxTemplate
+	for i := range opts.Templates {
+		if opts.Templates[i].Name == ref.Name {
+			template = &opts.Templates[i]
+		}
+	}
+	snapshot := sandbox.Status.Template
+	if snapshot != nil && snapshot.Name != ref.Name {
+		snapshot = nil
+	}
+	switch {
+	case template == nil && snapshot == nil:
+		return inspectv1alpha1.InspectSandboxSpec{}, fmt.Errorf(
+			"sandbox %s refers to template %s, which was not given", sandbox.Name, ref.Name)
+	case snapshot == nil, template != nil && ref.UpdatePolicy == inspectv1alpha1.TemplateUpdateRollout:
+		snapshot = newTemplateSnapshot(template)
+	}
+
+	spec := mergeSandboxSpec(&snapshot.Spec, &sandbox.Spec)
+	if opts.Defaulter != nil {
+		opts.Defaulter.DefaultSpec(&spec)
+	}
+	return spec, nil
+}
+
+// RenderSandbox returns the child objects the operator would apply for
+// sandbox, in the order it applies them, without talking to a cluster.
+// Owner references need the live sandbox's UID so are left unset.
+func RenderSandbox(sandbox *inspectv1alpha1.InspectSandbox, opts RenderOptions) ([]client.Object, error) {
+	spec, err := SandboxSpec(sandbox, opts)
+	if err != nil {
+		return nil, err
+	}
+	sandbox = sandbox.DeepCopy()
+	sandbox.Spec = spec
+	if errs := inspectv1alpha1.ValidateInspectSandboxSpec(sandbox.Name, &sandbox.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	var objects []client.Object
+
+	volNames := make([]string, 0, len(sandbox.Spec.Volumes))
+	for volName := range sandbox.Spec.Volumes {
+		volNames = append(volNames, volName)
+	}
+	sort.Strings(volNames)
+	for _, volName := range volNames {
+		pvc, err := buildPersistentVolumeClaim(sandbox, volName, sandbox.Spec.Volumes[volName])
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, &pvc)
+	}
+
+	if sandboxUsesDNSResolver(sandbox) {
+		aliases, err := sandboxDNSAliases(sandbox)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ClusterDNS == "" {
+			return nil, fmt.Errorf("the cluster DNS address is needed to render the DNS resolver config")
+		}
+		clusterDomain := opts.ClusterDomain
+		if clusterDomain == "" {
+			clusterDomain = defaultClusterDomain
+		}
+		configMap := buildDNSConfigMap(sandbox, aliases, clusterDomain, opts.ClusterDNS)
+		objects = append(objects, &configMap)
+	}
+
+	// Validation has ruled out dependency cycles
+	svcNames, err := inspectv1alpha1.ServiceStartOrder(sandbox.Spec.Services)
+	if err != nil {
+		return nil, err
+	}
+	for _, svcName := range svcNames {
+		svcSpec := sandbox.Spec.Services[svcName]
+		if err := validateServiceVolumes(sandbox, svcSpec); err != nil {
+			return nil, err
+		}
+		sts := buildStatefulSet(sandbox, svcName, svcSpec)
+		service := buildKubeService(sandbox, svcName, svcSpec)
+		objects = append(objects, &sts, &service)
+	}
+
+	backend := opts.NetworkPolicyBackend
+	if backend == "" {
+		backend = NetworkPolicyBackendCilium
+	}
+	objects = append(objects, buildNetworkPolicies(sandbox, backend)...)
+
+	return objects, nil
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+func TestRenderSandboxServiceOrder(t *testing.T) {
+	sandbox := newDNSSandbox(map[string]inspectv1alpha1.ServiceSpec{
+		"app":   {Image: "app", DependsOn: []inspectv1alpha1.ServiceDependency{{Service: "db"}}},
+		"db":    {Image: "postgres", DependsOn: []inspectv1alpha1.ServiceDependency{{Service: "cache"}}},
+		"cache": {Image: "redis"},
+	})
+
+	objects, err := RenderSandbox(sandbox, RenderOptions{ClusterDNS: "10.96.0.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, obj := range objects {
+		if _, ok := obj.(*appsv1.StatefulSet); ok {
+			got = append(got, obj.GetName())
+		}
+	}
+	want := []string{"task-cache", "task-db", "task-app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statefulsets in order %v, want %v", got, want)
+	}
+}
+
+func TestSandboxSpecTemplate(t *testing.T) {
+	template := func(generation int64, image string) inspectv1alpha1.InspectSandboxTemplate {
+		return inspectv1alpha1.InspectSandboxTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "evals", Generation: generation},
+			Spec: inspectv1alpha1.InspectSandboxSpec{Services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: image},
+			}},
+		}
+	}
+	snapshot := func(name string, generation int64, image string) *inspectv1alpha1.TemplateSnapshot {
+		tmpl := template(generation, image)
+		tmpl.Name = name
+		return newTemplateSnapshot(&tmpl)
+	}
+
+	tests := []struct {
+		name      string
+		templates []inspectv1alpha1.InspectSandboxTemplate
+		snapshot  *inspectv1alpha1.TemplateSnapshot
+		policy    inspectv1alpha1.TemplateUpdatePolicy
+		wantImage string
+		wantErr   bool
+	}{
+		{
+			name:      "new sandbox",
+			templates: []inspectv1alpha1.InspectSandboxTemplate{template(2, "ubuntu:24.04")},
+			wantImage: "ubuntu:24.04",
+		},
+		{
+			name:      "created from an older template",
+			templates: []inspectv1alpha1.InspectSandboxTemplate{template(2, "ubuntu:24.04")},
+			snapshot:  snapshot("base", 1, "ubuntu:22.04"),
+			wantImage: "ubuntu:22.04",
+		},
+		{
+			name:      "rolls out template changes",
+			templates: []inspectv1alpha1.InspectSandboxTemplate{template(2, "ubuntu:24.04")},
+			snapshot:  snapshot("base", 1, "ubuntu:22.04"),
+			policy:    inspectv1alpha1.TemplateUpdateRollout,
+			wantImage: "ubuntu:24.04",
+		},
+		{
+			name:      "template deleted",
+			snapshot:  snapshot("base", 1, "ubuntu:22.04"),
+			wantImage: "ubuntu:22.04",
+		},
+		{
+			name:      "snapshot of another template",
+			templates: []inspectv1alpha1.InspectSandboxTemplate{template(2, "ubuntu:24.04")},
+			snapshot:  snapshot("old", 1, "ubuntu:22.04"),
+			wantImage: "ubuntu:24.04",
+		},
+		{
+			name:    "template missing",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(nil)
+			sandbox.Spec.TemplateRef = &inspectv1alpha1.TemplateReference{Name: "base", UpdatePolicy: tt.policy}
+			sandbox.Status.Template = tt.snapshot
+
+			spec, err := SandboxSpec(sandbox, RenderOptions{Templates: tt.templates})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := spec.Services["default"].Image; got != tt.wantImage {
+				t.Errorf("image = %q, want %q", got, tt.wantImage)
+			}
+			if spec.TemplateRef != nil {
+				t.Error("spec still refers to the template")
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// defaultFailureGracePeriod is used when neither the sandbox nor the
+// reconciler configure a failure grace period
+const defaultFailureGracePeriod = 2 * time.Minute
+
+// buildServiceStatus reports the state of a service from its StatefulSet
+// and the pod running it
+func (r *InspectSandboxReconciler) buildServiceStatus(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	svcName string,
+	sts *appsv1.StatefulSet,
+) (inspectv1alpha1.ServiceStatus, error) {
+	// DNS names were validated by reconcileDNSConfig
+	aliases, _ := sandboxDNSAliases(sandbox)
+	status := inspectv1alpha1.ServiceStatus{
+		Ready:    sts.Status.ReadyReplicas > 0,
+		Message:  getStatusMessage(sts),
+		DNSNames: serviceDNSNames(aliases, svcName),
+	}
+
+	// Each service runs as a single replica, so look at its only pod
+	var pod corev1.Pod
+	podName := types.NamespacedName{
+		Name:      fmt.Sprintf("%s-0", sts.Name),
+		Namespace: sts.Namespace,
+	}
+	err := r.Get(ctx, podName, &pod)
+	if err != nil && !errors.IsNotFound(err) {
+		return status, err
+	}
+
+	// Nothing can fail while the service is scaled down on purpose
+	if errors.IsNotFound(err) && sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0 {
+		status.Message = "Service is scaled to zero"
+		return status, nil
+	}
+
+	var reason, message string
+	if errors.IsNotFound(err) {
+		// The StatefulSet couldn't create the pod, e.g. because of quota or
+		// a missing runtime class, which only shows up in its events
+		reason, message, err = r.latestWarningEvent(ctx, sts, "StatefulSet", failingStatefulSetEvents)
+		if err != nil {
+			return status, err
+		}
+	} else {
+		status.PodName = pod.Name
+		status.PodIP = pod.Status.PodIP
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if containerStatus.Name != svcName {
+				continue
+			}
+			status.Started = containerStatus.State.Running != nil
+			status.RestartCount = containerStatus.RestartCount
+			status.ImageID = containerStatus.ImageID
+			if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil {
+				status.LastTerminationReason = terminated.Reason
+			}
+		}
+
+		reason, message = podFailure(&pod)
+		if reason == "" && pod.Status.Phase == corev1.PodPending && pod.DeletionTimestamp.IsZero() {
+			// Volume and sandbox creation failures are only reported as events
+			reason, message, err = r.latestWarningEvent(ctx, &pod, "Pod", failingPodEvents)
+			if err != nil {
+				return status, err
+			}
+		}
+	}
+
+	if reason != "" && !status.Ready {
+		status.Reason = reason
+		status.Message = message
+
+		// Keep the original timestamp while the service keeps failing
+		previous := sandbox.Status.Services[svcName]
+		if previous.Reason != "" && previous.FailingSince != nil {
+			status.FailingSince = previous.FailingSince
+		} else {
+			status.FailingSince = pointer(metav1.Now())
+		}
+	}
+
+	return status, nil
+}
+
+// failingContainerReasons are waiting reasons a container won't recover
+// from without intervention
+var failingContainerReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"RunContainerError":          true,
+}
+
+// failingPodEvents are Warning event reasons that keep a pending pod from
+// starting
+var failingPodEvents = map[string]bool{
+	"FailedAttachVolume":     true,
+	"FailedCreatePodSandBox": true,
+	"FailedMount":            true,
+}
+
+// failingStatefulSetEvents are Warning event reasons that stop a
+// StatefulSet from creating its pod
+var failingStatefulSetEvents = map[string]bool{
+	"FailedCreate": true,
+}
+
+// podFailure returns the reason and message for why a pod isn't running,
+// or empty strings if nothing is obviously wrong
+func podFailure(pod *corev1.Pod) (string, string) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled &&
+			condition.Status == corev1.ConditionFalse &&
+			condition.Reason == corev1.PodReasonUnschedulable {
+			return condition.Reason, condition.Message
+		}
+	}
+
+	containerStatuses := append(append([]corev1.ContainerStatus{},
+		pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, containerStatus := range containerStatuses {
+		if terminated := containerStatus.State.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			return terminated.Reason, fmt.Sprintf("Container %s was killed for exceeding its memory limit", containerStatus.Name)
+		}
+
+		waiting := containerStatus.State.Waiting
+		if waiting == nil || !failingContainerReasons[waiting.Reason] {
+			continue
+		}
+
+		// Crash loops are more useful reported by why the container exited
+		reason := waiting.Reason
+		message := fmt.Sprintf("Container %s: %s", containerStatus.Name, waiting.Message)
+		if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil && reason == "CrashLoopBackOff" {
+			message = fmt.Sprintf("Container %s is crash looping, last exit code %d (%s)",
+				containerStatus.Name, terminated.ExitCode, terminated.Reason)
+			if terminated.Reason == "OOMKilled" {
+				reason = terminated.Reason
+			}
+		}
+		return reason, message
+	}
+
+	return "", ""
+}
+
+// latestWarningEvent returns the reason and message of the most recent
+// Warning event with one of the given reasons recorded against obj. Events
+// are read straight from the API server so the manager doesn't cache every
+// event in the cluster.
+func (r *InspectSandboxReconciler) latestWarningEvent(
+	ctx context.Context,
+	obj client.Object,
+	kind string,
+	reasons map[string]bool,
+) (string, string, error) {
+	if r.APIReader == nil {
+		return "", "", nil
+	}
+
+	var events corev1.EventList
+	if err := r.APIReader.List(ctx, &events,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{
+			"involvedObject.kind": kind,
+			"involvedObject.name": obj.GetName(),
+			"involvedObject.uid":  string(obj.GetUID()),
+			"type":                corev1.EventTypeWarning,
+		},
+	); err != nil {
+		return "", "", err
+	}
+
+	var latest *corev1.Event
+	for i := range events.Items {
+		if !reasons[events.Items[i].Reason] {
+			continue
+		}
+		if latest == nil || eventTime(&events.Items[i]).After(eventTime(latest)) {
+			latest = &events.Items[i]
+		}
+	}
+	if latest == nil {
+		return "", "", nil
+	}
+	return latest.Reason, latest.Message, nil
+}
+
+// eventTime returns when an event was last seen
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// failureGracePeriod returns how long services may fail before the sandbox
+// is marked Failed
+func (r *InspectSandboxReconciler) failureGracePeriod(sandbox *inspectv1alpha1.InspectSandbox) time.Duration {
+	if sandbox.Spec.FailureGracePeriodSeconds != nil {
+		return time.Duration(*sandbox.Spec.FailureGracePeriodSeconds) * time.Second
+	}
+	if r.FailureGracePeriod > 0 {
+		return r.FailureGracePeriod
+	}
+	return defaultFailureGracePeriod
+}
+
+// updateStatusConditions sets the sandbox's conditions, phase and observed
+// generation from the outcome of this reconcile. It returns how long until
+// a failing service exceeds its grace period, or zero if none are pending.
+func (r *InspectSandboxReconciler) updateStatusConditions(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	policyErr error,
+) (time.Duration, error) {
+	// Network policies
+	policyCondition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionNetworkPolicyReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "PoliciesApplied",
+		Message:            fmt.Sprintf("Network policies are in place using the %s backend", r.networkPolicyBackend()),
+	}
+	if policyErr != nil {
+		policyCondition.Status = metav1.ConditionFalse
+		policyCondition.Reason = "PolicyReconcileFailed"
+		policyCondition.Message = policyErr.Error()
+	}
+	previousPolicy := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionNetworkPolicyReady)
+	if previousPolicy == nil || previousPolicy.Status != policyCondition.Status {
+		if policyErr != nil {
+			r.Recorder.Eventf(sandbox, corev1.EventTypeWarning, eventReasonPoliciesFailed,
+				"Network policies could not be applied: %v", policyErr)
+		} else {
+			r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonPoliciesApplied, policyCondition.Message)
+		}
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, policyCondition)
+	r.setDomainAllowListCondition(sandbox)
+
+	// Volumes
+	volumesCondition, err := r.volumesCondition(ctx, sandbox)
+	if err != nil {
+		return 0, err
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, volumesCondition)
+
+	// Overall readiness
+	var notReady []string
+	podsCreated := false
+	for svcName := range sandbox.Spec.Services {
+		svcStatus := sandbox.Status.Services[svcName]
+		if !svcStatus.Ready {
+			notReady = append(notReady, svcName)
+		}
+		if svcStatus.PodName != "" {
+			podsCreated = true
+		}
+	}
+	sort.Strings(notReady)
+
+	readyCondition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "AllServicesReady",
+		Message:            "All services are ready",
+	}
+	switch {
+	case sandbox.Spec.Suspend:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = "Suspended"
+		readyCondition.Message = "Sandbox is suspended"
+	case len(notReady) > 0:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = "ServicesNotReady"
+		readyCondition.Message = fmt.Sprintf("Services not ready: %s", strings.Join(notReady, ", "))
+	case policyErr != nil:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = "NetworkPolicyNotReady"
+		readyCondition.Message = "Network policies could not be applied"
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, readyCondition)
+	if readyCondition.Status == metav1.ConditionTrue && sandbox.Status.FirstReadyTime == nil {
+		now := metav1.Now()
+		sandbox.Status.FirstReadyTime = &now
+		timeToReady.WithLabelValues(sandbox.Namespace).Observe(sinceCreation(sandbox))
+	}
+
+	// Failures that outlast the grace period
+	failedCondition, requeueAfter := r.failedCondition(sandbox)
+	meta.SetStatusCondition(&sandbox.Status.Conditions, failedCondition)
+
+	// Phase
+	previousPhase := sandbox.Status.Phase
+	switch {
+	case sandbox.Spec.Suspend:
+		sandbox.Status.Phase = inspectv1alpha1.PhaseSuspended
+	case failedCondition.Status == metav1.ConditionTrue:
+		sandbox.Status.Phase = inspectv1alpha1.PhaseFailed
+	case readyCondition.Status == metav1.ConditionTrue:
+		sandbox.Status.Phase = inspectv1alpha1.PhaseReady
+	case previousPhase == inspectv1alpha1.PhaseReady || previousPhase == inspectv1alpha1.PhaseDegraded:
+		sandbox.Status.Phase = inspectv1alpha1.PhaseDegraded
+	case podsCreated:
+		sandbox.Status.Phase = inspectv1alpha1.PhaseProvisioning
+	default:
+		sandbox.Status.Phase = inspectv1alpha1.PhasePending
+	}
+
+	// Mark the milestones on the sandbox's timeline
+	if sandbox.Status.Phase != previousPhase {
+		switch sandbox.Status.Phase {
+		case inspectv1alpha1.PhaseReady:
+			r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonReady, readyCondition.Message)
+		case inspectv1alpha1.PhaseFailed:
+			r.Recorder.Event(sandbox, corev1.EventTypeWarning, eventReasonFailed, failedCondition.Message)
+		}
+	}
+
+	sandbox.Status.ObservedGeneration = sandbox.Generation
+	return requeueAfter, nil
+}
+
+// failedCondition reports whether any service has been failing for longer
+// than the grace period, and otherwise how long until the next one will
+func (r *InspectSandboxReconciler) failedCondition(
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (metav1.Condition, time.Duration) {
+	if deadlineExceeded(sandbox) {
+		deadline := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionDeadlineExceeded)
+		return metav1.Condition{
+			Type:               inspectv1alpha1.ConditionFailed,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: sandbox.Generation,
+			Reason:             deadline.Reason,
+			Message:            deadline.Message,
+		}, 0
+	}
+
+	gracePeriod := r.failureGracePeriod(sandbox)
+
+	var failed []string
+	var reasons []string
+	var requeueAfter time.Duration
+	for svcName := range sandbox.Spec.Services {
+		svcStatus := sandbox.Status.Services[svcName]
+		if svcStatus.Reason == "" || svcStatus.FailingSince == nil {
+			continue
+		}
+		remaining := gracePeriod - time.Since(svcStatus.FailingSince.Time)
+		if remaining > 0 {
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s", svcName, svcStatus.Message))
+		reasons = append(reasons, svcStatus.Reason)
+	}
+	sort.Strings(failed)
+
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionFailed,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "NoFailures",
+		Message:            "No services are failing",
+	}
+	if len(failed) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ServicesFailing"
+		if len(reasons) == 1 {
+			condition.Reason = reasons[0]
+		}
+		condition.Message = strings.Join(failed, "; ")
+	}
+	return condition, requeueAfter
+}
+
+// volumesCondition reports whether every volume claim in the sandbox is bound
+func (r *InspectSandboxReconciler) volumesCondition(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+) (metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionVolumesReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "AllVolumesBound",
+		Message:            "All volume claims are bound",
+	}
+	if len(sandbox.Spec.Volumes) == 0 {
+		condition.Reason = "NoVolumes"
+		condition.Message = "The sandbox has no volumes"
+		return condition, nil
+	}
+
+	var unbound []string
+	for volName := range sandbox.Spec.Volumes {
+		var pvc corev1.PersistentVolumeClaim
+		pvcName := types.NamespacedName{
+			Name:      fmt.Sprintf("%s-%s", sandbox.Name, volName),
+			Namespace: sandbox.Namespace,
+		}
+		if err := r.Get(ctx, pvcName, &pvc); err != nil {
+			if !errors.IsNotFound(err) {
+				return condition, err
+			}
+			unbound = append(unbound, volName)
+			continue
+		}
+		if pvc.Status.Phase != corev1.ClaimBound {
+			unbound = append(unbound, volName)
+		}
+	}
+	sort.Strings(unbound)
+
+	if len(unbound) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "VolumesNotBound"
+		condition.Message = fmt.Sprintf("Volumes not bound: %s", strings.Join(unbound, ", "))
+	}
+	return condition, nil
+}
+
+// podToSandbox maps a sandbox pod to a reconcile request for its sandbox
+func podToSandbox(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["app.kubernetes.io/managed-by"] != "inspect-operator" {
+		return nil
+	}
+	sandboxName := labels["app.kubernetes.io/instance"]
+	if sandboxName == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Name:      sandboxName,
+			Namespace: obj.GetNamespace(),
+		},
+	}}
+}
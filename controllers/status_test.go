@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+func TestUpdateStatusConditions(t *testing.T) {
+	tests := []struct {
+		name          string
+		previousPhase inspectv1alpha1.SandboxPhase
+		services      map[string]inspectv1alpha1.ServiceStatus
+		policyErr     error
+		wantPhase     inspectv1alpha1.SandboxPhase
+		wantReason    string
+		wantMessage   string
+	}{
+		{
+			name:        "nothing created yet",
+			wantPhase:   inspectv1alpha1.PhasePending,
+			wantReason:  "ServicesNotReady",
+			wantMessage: "Services not ready: db, default",
+		},
+		{
+			name: "pods starting",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"default": {PodName: "task-default-0", Ready: true},
+				"db":      {PodName: "task-db-0"},
+			},
+			wantPhase:   inspectv1alpha1.PhaseProvisioning,
+			wantReason:  "ServicesNotReady",
+			wantMessage: "Services not ready: db",
+		},
+		{
+			name: "all ready",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"default": {PodName: "task-default-0", Ready: true},
+				"db":      {PodName: "task-db-0", Ready: true},
+			},
+			wantPhase:   inspectv1alpha1.PhaseReady,
+			wantReason:  "AllServicesReady",
+			wantMessage: "All services are ready",
+		},
+		{
+			name:          "service lost after ready",
+			previousPhase: inspectv1alpha1.PhaseReady,
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"default": {PodName: "task-default-0", Ready: true},
+			},
+			wantPhase:   inspectv1alpha1.PhaseDegraded,
+			wantReason:  "ServicesNotReady",
+			wantMessage: "Services not ready: db",
+		},
+		{
+			name:          "still degraded",
+			previousPhase: inspectv1alpha1.PhaseDegraded,
+			wantPhase:     inspectv1alpha1.PhaseDegraded,
+			wantReason:    "ServicesNotReady",
+			wantMessage:   "Services not ready: db, default",
+		},
+		{
+			name: "policies failed",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"default": {PodName: "task-default-0", Ready: true},
+				"db":      {PodName: "task-db-0", Ready: true},
+			},
+			policyErr:   errors.New("no policy backend"),
+			wantPhase:   inspectv1alpha1.PhaseProvisioning,
+			wantReason:  "NetworkPolicyNotReady",
+			wantMessage: "Network policies could not be applied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu"},
+				"db":      {Image: "postgres"},
+			})
+			sandbox.Generation = 3
+			sandbox.Status.Phase = tt.previousPhase
+			sandbox.Status.Services = tt.services
+			r := &InspectSandboxReconciler{Client: newFakeClient(), Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			if _, err := r.updateStatusConditions(context.Background(), sandbox, tt.policyErr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if sandbox.Status.Phase != tt.wantPhase {
+				t.Errorf("phase = %s, want %s", sandbox.Status.Phase, tt.wantPhase)
+			}
+			if sandbox.Status.ObservedGeneration != 3 {
+				t.Errorf("observedGeneration = %d, want 3", sandbox.Status.ObservedGeneration)
+			}
+			ready := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionReady)
+			if ready == nil {
+				t.Fatal("Ready condition not set")
+			}
+			if ready.Reason != tt.wantReason || ready.Message != tt.wantMessage {
+				t.Errorf("Ready = %s %q, want %s %q", ready.Reason, ready.Message, tt.wantReason, tt.wantMessage)
+			}
+			policies := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionNetworkPolicyReady)
+			wantStatus := metav1.ConditionTrue
+			if tt.policyErr != nil {
+				wantStatus = metav1.ConditionFalse
+			}
+			if policies == nil || policies.Status != wantStatus {
+				t.Errorf("NetworkPolicyReady = %v, want status %s", policies, wantStatus)
+			}
+		})
+	}
+}
+
+func TestPodFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      corev1.PodStatus
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name: "running",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "default",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}}},
+		},
+		{
+			name: "unschedulable",
+			status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  corev1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 3 Insufficient memory.",
+			}}},
+			wantReason:  "Unschedulable",
+			wantMessage: "0/3 nodes are available: 3 Insufficient memory.",
+		},
+		{
+			name: "image pull",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "default",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason:  "ImagePullBackOff",
+					Message: `Back-off pulling image "ubuntu:nope"`,
+				}},
+			}}},
+			wantReason:  "ImagePullBackOff",
+			wantMessage: `Container default: Back-off pulling image "ubuntu:nope"`,
+		},
+		{
+			name: "transient waiting reason",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "default",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+			}}},
+		},
+		{
+			name: "crash loop",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "default",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1,
+					Reason:   "Error",
+				}},
+			}}},
+			wantReason:  "CrashLoopBackOff",
+			wantMessage: "Container default is crash looping, last exit code 1 (Error)",
+		},
+		{
+			name: "crash loop from memory limit",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "default",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 137,
+					Reason:   "OOMKilled",
+				}},
+			}}},
+			wantReason:  "OOMKilled",
+			wantMessage: "Container default is crash looping, last exit code 137 (OOMKilled)",
+		},
+		{
+			name: "init container killed",
+			status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "setup",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}},
+			}}},
+			wantReason:  "OOMKilled",
+			wantMessage: "Container setup was killed for exceeding its memory limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, message := podFailure(&corev1.Pod{Status: tt.status})
+			if reason != tt.wantReason || message != tt.wantMessage {
+				t.Errorf("podFailure() = %q, %q, want %q, %q", reason, message, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestFailedCondition(t *testing.T) {
+	failingFor := func(d time.Duration, reason, message string) inspectv1alpha1.ServiceStatus {
+		since := metav1.NewTime(time.Now().Add(-d))
+		return inspectv1alpha1.ServiceStatus{Reason: reason, Message: message, FailingSince: &since}
+	}
+
+	tests := []struct {
+		name        string
+		gracePeriod *int32
+		services    map[string]inspectv1alpha1.ServiceStatus
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+		wantMessage string
+		wantRequeue bool
+	}{
+		{
+			name:        "healthy",
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "NoFailures",
+			wantMessage: "No services are failing",
+		},
+		{
+			name: "within grace period",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"db": failingFor(time.Minute, "ImagePullBackOff", "Container db: back-off"),
+			},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "NoFailures",
+			wantMessage: "No services are failing",
+			wantRequeue: true,
+		},
+		{
+			name: "past grace period",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"db": failingFor(3*time.Minute, "ImagePullBackOff", "Container db: back-off"),
+			},
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  "ImagePullBackOff",
+			wantMessage: "db: Container db: back-off",
+		},
+		{
+			name:        "sandbox grace period",
+			gracePeriod: ptrInt32(600),
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"db": failingFor(3*time.Minute, "ImagePullBackOff", "Container db: back-off"),
+			},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "NoFailures",
+			wantMessage: "No services are failing",
+			wantRequeue: true,
+		},
+		{
+			name: "several services",
+			services: map[string]inspectv1alpha1.ServiceStatus{
+				"db":      failingFor(3*time.Minute, "ImagePullBackOff", "Container db: back-off"),
+				"default": failingFor(5*time.Minute, "CrashLoopBackOff", "Container default is crash looping"),
+			},
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  "ServicesFailing",
+			wantMessage: "db: Container db: back-off; default: Container default is crash looping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: "ubuntu"},
+				"db":      {Image: "postgres"},
+			})
+			sandbox.Spec.FailureGracePeriodSeconds = tt.gracePeriod
+			sandbox.Status.Services = tt.services
+			r := &InspectSandboxReconciler{Client: newFakeClient(), Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			got, requeueAfter := r.failedCondition(sandbox)
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason || got.Message != tt.wantMessage {
+				t.Errorf("condition = %s %s %q, want %s %s %q",
+					got.Status, got.Reason, got.Message, tt.wantStatus, tt.wantReason, tt.wantMessage)
+			}
+			if (requeueAfter > 0) != tt.wantRequeue {
+				t.Errorf("requeueAfter = %v, want requeue %v", requeueAfter, tt.wantRequeue)
+			}
+		})
+	}
+}
+
+func TestVolumesCondition(t *testing.T) {
+	pvc := func(name string, phase corev1.PersistentVolumeClaimPhase) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "evals"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		volumes     []string
+		pvcs        []client.Object
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name:        "no volumes",
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  "NoVolumes",
+			wantMessage: "The sandbox has no volumes",
+		},
+		{
+			name:        "all bound",
+			volumes:     []string{"data", "cache"},
+			pvcs:        []client.Object{pvc("task-data", corev1.ClaimBound), pvc("task-cache", corev1.ClaimBound)},
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  "AllVolumesBound",
+			wantMessage: "All volume claims are bound",
+		},
+		{
+			name:        "pending and missing",
+			volumes:     []string{"data", "cache", "logs"},
+			pvcs:        []client.Object{pvc("task-data", corev1.ClaimBound), pvc("task-cache", corev1.ClaimPending)},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "VolumesNotBound",
+			wantMessage: "Volumes not bound: cache, logs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(nil)
+			for _, volName := range tt.volumes {
+				if sandbox.Spec.Volumes == nil {
+					sandbox.Spec.Volumes = map[string]inspectv1alpha1.VolumeSpec{}
+				}
+				sandbox.Spec.Volumes[volName] = inspectv1alpha1.VolumeSpec{}
+			}
+			r := &InspectSandboxReconciler{Client: newFakeClient(tt.pvcs...), Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			got, err := r.volumesCondition(context.Background(), sandbox)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason || got.Message != tt.wantMessage {
+				t.Errorf("condition = %s %s %q, want %s %s %q",
+					got.Status, got.Reason, got.Message, tt.wantStatus, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
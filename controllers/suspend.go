@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// setSuspendedCondition records whether the sandbox is suspended, and
+// marks the moment it is suspended or resumed with an event
+func (r *InspectSandboxReconciler) setSuspendedCondition(sandbox *inspectv1alpha1.InspectSandbox) {
+	previous := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionSuspended)
+
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionSuspended,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             "Suspended",
+		Message:            "Services are scaled to zero, volumes and policies are kept",
+	}
+	if !sandbox.Spec.Suspend {
+		// Sandboxes that were never suspended don't need the condition
+		if previous == nil {
+			return
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Resumed"
+		condition.Message = "Services are running"
+	}
+
+	if previous == nil || previous.Status != condition.Status {
+		if sandbox.Spec.Suspend {
+			r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonSuspended, condition.Message)
+		} else {
+			r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonResumed, "Scaling services back up")
+		}
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, condition)
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// templateRetryInterval is how often a sandbox whose template can't be
+// resolved is retried, besides whenever a template changes
+const templateRetryInterval = 30 * time.Second
+
+// Reasons for the TemplateResolved condition
+const (
+	templateReasonResolved  = "Resolved"
+	templateReasonRolledOut = "RolledOut"
+	templateReasonOutOfDate = "OutOfDate"
+	templateReasonDeleted   = "TemplateDeleted"
+	templateReasonNotFound  = "TemplateNotFound"
+	templateReasonInvalid   = "InvalidTemplate"
+)
+
+// resolveTemplate replaces the sandbox's spec with its template merged with
+// the spec's overrides, snapshotting the template in status the first time
+// and whenever a change is rolled out. It returns false, having recorded
+// why in status, if the sandbox can't be built yet.
+func (r *InspectSandboxReconciler) resolveTemplate(ctx context.Context, sandbox *inspectv1alpha1.InspectSandbox) (bool, error) {
+	ref := sandbox.Spec.TemplateRef
+	if ref == nil {
+		sandbox.Status.Template = nil
+		meta.RemoveStatusCondition(&sandbox.Status.Conditions, inspectv1alpha1.ConditionTemplateResolved)
+		return true, nil
+	}
+
+	var template inspectv1alpha1.InspectSandboxTemplate
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: sandbox.Namespace}, &template)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	snapshot := sandbox.Status.Template
+	if snapshot != nil && snapshot.Name != ref.Name {
+		snapshot = nil
+	}
+
+	condition := metav1.Condition{
+		Type:               inspectv1alpha1.ConditionTemplateResolved,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sandbox.Generation,
+	}
+	switch {
+	case errors.IsNotFound(err) && snapshot == nil:
+		return false, r.templateNotResolved(ctx, sandbox, templateReasonNotFound,
+			fmt.Sprintf("InspectSandboxTemplate %s not found", ref.Name))
+
+	case errors.IsNotFound(err):
+		// Keep running what was built before the template went away
+		condition.Reason = templateReasonDeleted
+		condition.Message = fmt.Sprintf("Template %s has been deleted, still using generation %d",
+			ref.Name, snapshot.Generation)
+
+	case snapshot == nil:
+		snapshot = newTemplateSnapshot(&template)
+		condition.Reason = templateReasonResolved
+		condition.Message = fmt.Sprintf("Built from template %s generation %d", ref.Name, template.Generation)
+
+	case snapshot.Generation == template.Generation:
+		condition.Reason = templateReasonResolved
+		condition.Message = fmt.Sprintf("Built from template %s generation %d", ref.Name, template.Generation)
+
+	case ref.UpdatePolicy == inspectv1alpha1.TemplateUpdateRollout:
+		snapshot = newTemplateSnapshot(&template)
+		condition.Reason = templateReasonRolledOut
+		condition.Message = fmt.Sprintf("Rolled out template %s generation %d", ref.Name, template.Generation)
+
+	default:
+		condition.Reason = templateReasonOutOfDate
+		condition.Message = fmt.Sprintf(
+			"Template %s has changed since generation %d, set updatePolicy to Rollout to apply changes",
+			ref.Name, snapshot.Generation)
+	}
+
+	spec := mergeSandboxSpec(&snapshot.Spec, &sandbox.Spec)
+	if r.Defaulter != nil {
+		r.Defaulter.DefaultSpec(&spec)
+	}
+	if errs := inspectv1alpha1.ValidateInspectSandboxSpec(sandbox.Name, &spec, field.NewPath("spec")); len(errs) > 0 {
+		return false, r.templateNotResolved(ctx, sandbox, templateReasonInvalid,
+			fmt.Sprintf("Template %s merged with the sandbox spec is invalid: %v", ref.Name, errs.ToAggregate()))
+	}
+
+	if condition.Reason == templateReasonRolledOut {
+		r.Recorder.Event(sandbox, corev1.EventTypeNormal, eventReasonTemplateRolledOut, condition.Message)
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, condition)
+	sandbox.Status.Template = snapshot
+	sandbox.Spec = spec
+	return true, nil
+}
+
+// templateNotResolved records why the sandbox can't be built from its
+// template and saves status
+func (r *InspectSandboxReconciler) templateNotResolved(
+	ctx context.Context,
+	sandbox *inspectv1alpha1.InspectSandbox,
+	reason, message string,
+) error {
+	previous := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionTemplateResolved)
+	if previous == nil || previous.Reason != reason {
+		r.Recorder.Event(sandbox, corev1.EventTypeWarning, eventReasonTemplateNotResolved, message)
+	}
+	meta.SetStatusCondition(&sandbox.Status.Conditions, metav1.Condition{
+		Type:               inspectv1alpha1.ConditionTemplateResolved,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sandbox.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	return r.Status().Update(ctx, sandbox)
+}
+
+// newTemplateSnapshot copies template for a sandbox's status
+func newTemplateSnapshot(template *inspectv1alpha1.InspectSandboxTemplate) *inspectv1alpha1.TemplateSnapshot {
+	snapshot := &inspectv1alpha1.TemplateSnapshot{
+		Name:       template.Name,
+		Generation: template.Generation,
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	snapshot.Spec.TemplateRef = nil
+	snapshot.Spec.Suspend = false
+	return snapshot
+}
+
+// templateSpec returns the spec a sandbox was last built with, from the
+// template snapshot in its status, without reading the template again
+func templateSpec(sandbox *inspectv1alpha1.InspectSandbox) inspectv1alpha1.InspectSandboxSpec {
+	snapshot := sandbox.Status.Template
+	if sandbox.Spec.TemplateRef == nil || snapshot == nil {
+		return sandbox.Spec
+	}
+	return mergeSandboxSpec(&snapshot.Spec, &sandbox.Spec)
+}
+
+// mergeSandboxSpec returns base with the fields set in overrides layered on
+// top. Maps such as services, networks and volumes are merged by key, env
+// and resources by name, and any other list that is set replaces the
+// template's. Suspend always comes from overrides, since templates can't
+// set it. The result no longer refers to a template.
+func mergeSandboxSpec(base, overrides *inspectv1alpha1.InspectSandboxSpec) inspectv1alpha1.InspectSandboxSpec {
+	spec := *base.DeepCopy()
+	spec.TemplateRef = nil
+	overrides = overrides.DeepCopy()
+
+	for svcName, svcSpec := range overrides.Services {
+		if spec.Services == nil {
+			spec.Services = map[string]inspectv1alpha1.ServiceSpec{}
+		}
+		if baseSvc, ok := spec.Services[svcName]; ok {
+			svcSpec = mergeServiceSpec(baseSvc, svcSpec)
+		}
+		spec.Services[svcName] = svcSpec
+	}
+	for network, description := range overrides.Networks {
+		if spec.Networks == nil {
+			spec.Networks = map[string]string{}
+		}
+		spec.Networks[network] = description
+	}
+	for volName, volSpec := range overrides.Volumes {
+		if spec.Volumes == nil {
+			spec.Volumes = map[string]inspectv1alpha1.VolumeSpec{}
+		}
+		spec.Volumes[volName] = volSpec
+	}
+
+	if overrides.AllowDomains != nil {
+		spec.AllowDomains = overrides.AllowDomains
+	}
+	if overrides.FailureGracePeriodSeconds != nil {
+		spec.FailureGracePeriodSeconds = overrides.FailureGracePeriodSeconds
+	}
+	if overrides.VolumeRetentionPolicy != "" {
+		spec.VolumeRetentionPolicy = overrides.VolumeRetentionPolicy
+	}
+	if overrides.TTLSecondsAfterCreation != nil {
+		spec.TTLSecondsAfterCreation = overrides.TTLSecondsAfterCreation
+	}
+	if overrides.TTLSecondsAfterReady != nil {
+		spec.TTLSecondsAfterReady = overrides.TTLSecondsAfterReady
+	}
+	if overrides.ActiveDeadlineSeconds != nil {
+		spec.ActiveDeadlineSeconds = overrides.ActiveDeadlineSeconds
+	}
+	if overrides.Heartbeat != nil {
+		spec.Heartbeat = overrides.Heartbeat
+	}
+	// Only the sandbox decides whether it is suspended
+	spec.Suspend = overrides.Suspend
+
+	return spec
+}
+
+// mergeServiceSpec layers the fields set in overrides on top of base
+func mergeServiceSpec(base, overrides inspectv1alpha1.ServiceSpec) inspectv1alpha1.ServiceSpec {
+	if overrides.Image != "" {
+		base.Image = overrides.Image
+	}
+	if overrides.RuntimeClassName != "" {
+		base.RuntimeClassName = overrides.RuntimeClassName
+	}
+	if overrides.Command != nil {
+		base.Command = overrides.Command
+	}
+	if overrides.Args != nil {
+		base.Args = overrides.Args
+	}
+	if overrides.WorkingDir != "" {
+		base.WorkingDir = overrides.WorkingDir
+	}
+	if overrides.DNSRecord != nil {
+		base.DNSRecord = overrides.DNSRecord
+	}
+	if overrides.AdditionalDNSRecords != nil {
+		base.AdditionalDNSRecords = overrides.AdditionalDNSRecords
+	}
+	if overrides.Volumes != nil {
+		base.Volumes = overrides.Volumes
+	}
+	if overrides.Networks != nil {
+		base.Networks = overrides.Networks
+	}
+	if overrides.Ports != nil {
+		base.Ports = overrides.Ports
+	}
+	if overrides.Healthcheck != nil {
+		base.Healthcheck = overrides.Healthcheck
+	}
+	if overrides.DependsOn != nil {
+		base.DependsOn = overrides.DependsOn
+	}
+
+	for _, env := range overrides.Env {
+		base.Env = setEnvVar(base.Env, env)
+	}
+
+	for name, quantity := range overrides.Resources.Requests {
+		if base.Resources.Requests == nil {
+			base.Resources.Requests = corev1.ResourceList{}
+		}
+		base.Resources.Requests[name] = quantity
+	}
+	for name, quantity := range overrides.Resources.Limits {
+		if base.Resources.Limits == nil {
+			base.Resources.Limits = corev1.ResourceList{}
+		}
+		base.Resources.Limits[name] = quantity
+	}
+
+	return base
+}
+
+// templateToSandboxes maps an InspectSandboxTemplate to the sandboxes that
+// refer to it, so they can roll out changes or stop waiting for it
+func (r *InspectSandboxReconciler) templateToSandboxes(ctx context.Context, obj client.Object) []reconcile.Request {
+	var sandboxes inspectv1alpha1.InspectSandboxList
+	if err := r.List(ctx, &sandboxes, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list sandboxes for template", "template", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, sandbox := range sandboxes.Items {
+		if ref := sandbox.Spec.TemplateRef; ref != nil && ref.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: sandbox.Name, Namespace: sandbox.Namespace},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+func TestMergeSandboxSpec(t *testing.T) {
+	resources := func(requests, limits corev1.ResourceList) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+
+	base := inspectv1alpha1.InspectSandboxSpec{
+		Services: map[string]inspectv1alpha1.ServiceSpec{
+			"default": {
+				Image:    "ubuntu",
+				Command:  []string{"sleep", "infinity"},
+				Networks: []string{"internal"},
+				Env:      []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}},
+				Resources: resources(
+					corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+					corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				),
+			},
+			"db": {Image: "postgres"},
+		},
+		Networks:                map[string]string{"internal": "services"},
+		Volumes:                 map[string]inspectv1alpha1.VolumeSpec{"data": {Size: "1Gi"}},
+		AllowDomains:            []string{"pypi.org"},
+		TTLSecondsAfterCreation: ptrInt32(3600),
+		Heartbeat:               &inspectv1alpha1.HeartbeatSpec{TimeoutSeconds: 300},
+	}
+
+	tests := []struct {
+		name      string
+		overrides inspectv1alpha1.InspectSandboxSpec
+		want      func(spec *inspectv1alpha1.InspectSandboxSpec)
+	}{
+		{
+			name: "only a template reference",
+			overrides: inspectv1alpha1.InspectSandboxSpec{
+				TemplateRef: &inspectv1alpha1.TemplateReference{Name: "base"},
+			},
+		},
+		{
+			name: "service fields layered over the template's",
+			overrides: inspectv1alpha1.InspectSandboxSpec{Services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {
+					Image: "ubuntu:24.04",
+					Env:   []corev1.EnvVar{{Name: "B", Value: "3"}, {Name: "C", Value: "4"}},
+					Resources: resources(
+						corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+						nil,
+					),
+				},
+			}},
+			want: func(spec *inspectv1alpha1.InspectSandboxSpec) {
+				svc := spec.Services["default"]
+				svc.Image = "ubuntu:24.04"
+				svc.Env = []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "3"}, {Name: "C", Value: "4"}}
+				svc.Resources.Requests[corev1.ResourceMemory] = resource.MustParse("2Gi")
+				spec.Services["default"] = svc
+			},
+		},
+		{
+			name: "maps merged by key",
+			overrides: inspectv1alpha1.InspectSandboxSpec{
+				Services: map[string]inspectv1alpha1.ServiceSpec{"cache": {Image: "redis"}},
+				Networks: map[string]string{"internal": "renamed", "public": ""},
+				Volumes:  map[string]inspectv1alpha1.VolumeSpec{"data": {Size: "5Gi"}, "logs": {}},
+			},
+			want: func(spec *inspectv1alpha1.InspectSandboxSpec) {
+				spec.Services["cache"] = inspectv1alpha1.ServiceSpec{Image: "redis"}
+				spec.Networks = map[string]string{"internal": "renamed", "public": ""}
+				spec.Volumes = map[string]inspectv1alpha1.VolumeSpec{"data": {Size: "5Gi"}, "logs": {}}
+			},
+		},
+		{
+			name: "lists replaced, even by empty ones",
+			overrides: inspectv1alpha1.InspectSandboxSpec{
+				Services: map[string]inspectv1alpha1.ServiceSpec{
+					"default": {Command: []string{"bash"}, Networks: []string{}},
+				},
+				AllowDomains: []string{"example.com"},
+			},
+			want: func(spec *inspectv1alpha1.InspectSandboxSpec) {
+				svc := spec.Services["default"]
+				svc.Command = []string{"bash"}
+				svc.Networks = []string{}
+				spec.Services["default"] = svc
+				spec.AllowDomains = []string{"example.com"}
+			},
+		},
+		{
+			name: "scalars replaced when set",
+			overrides: inspectv1alpha1.InspectSandboxSpec{
+				FailureGracePeriodSeconds: ptrInt32(60),
+				VolumeRetentionPolicy:     inspectv1alpha1.VolumeRetentionRetain,
+				TTLSecondsAfterCreation:   ptrInt32(60),
+				TTLSecondsAfterReady:      ptrInt32(30),
+				ActiveDeadlineSeconds:     ptrInt64(600),
+				Heartbeat:                 &inspectv1alpha1.HeartbeatSpec{TimeoutSeconds: 60, LeaseName: "run"},
+			},
+			want: func(spec *inspectv1alpha1.InspectSandboxSpec) {
+				spec.FailureGracePeriodSeconds = ptrInt32(60)
+				spec.VolumeRetentionPolicy = inspectv1alpha1.VolumeRetentionRetain
+				spec.TTLSecondsAfterCreation = ptrInt32(60)
+				spec.TTLSecondsAfterReady = ptrInt32(30)
+				spec.ActiveDeadlineSeconds = ptrInt64(600)
+				spec.Heartbeat = &inspectv1alpha1.HeartbeatSpec{TimeoutSeconds: 60, LeaseName: "run"}
+			},
+		},
+		{
+			name:      "suspend",
+			overrides: inspectv1alpha1.InspectSandboxSpec{Suspend: true},
+			want: func(spec *inspectv1alpha1.InspectSandboxSpec) {
+				spec.Suspend = true
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := base.DeepCopy()
+			want := base.DeepCopy()
+			if tt.want != nil {
+				tt.want(want)
+			}
+
+			got := mergeSandboxSpec(&base, &tt.overrides)
+
+			if !equality.Semantic.DeepEqual(got, *want) {
+				t.Errorf("merged spec =\n%+v\nwant\n%+v", got, *want)
+			}
+			if got.TemplateRef != nil {
+				t.Errorf("merged spec still refers to template %s", got.TemplateRef.Name)
+			}
+
+			// The result must not share anything with the template
+			got.Services["default"].Env[0].Value = "changed"
+			got.Services["default"].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("8")
+			got.Networks["changed"] = ""
+			if !equality.Semantic.DeepEqual(base, *before) {
+				t.Errorf("changing the merged spec changed the template")
+			}
+		})
+	}
+}
+
+func TestResolveTemplate(t *testing.T) {
+	template := func(generation int64, image string) *inspectv1alpha1.InspectSandboxTemplate {
+		return &inspectv1alpha1.InspectSandboxTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "evals", Generation: generation},
+			Spec: inspectv1alpha1.InspectSandboxSpec{Services: map[string]inspectv1alpha1.ServiceSpec{
+				"default": {Image: image},
+			}},
+		}
+	}
+	snapshot := func(generation int64, image string) *inspectv1alpha1.TemplateSnapshot {
+		return newTemplateSnapshot(template(generation, image))
+	}
+
+	tests := []struct {
+		name           string
+		template       *inspectv1alpha1.InspectSandboxTemplate
+		snapshot       *inspectv1alpha1.TemplateSnapshot
+		policy         inspectv1alpha1.TemplateUpdatePolicy
+		wantResolved   bool
+		wantReason     string
+		wantImage      string
+		wantGeneration int64
+	}{
+		{
+			name:       "template missing",
+			wantReason: templateReasonNotFound,
+		},
+		{
+			name:           "first build",
+			template:       template(1, "ubuntu:22.04"),
+			wantResolved:   true,
+			wantReason:     templateReasonResolved,
+			wantImage:      "ubuntu:22.04",
+			wantGeneration: 1,
+		},
+		{
+			name:           "template unchanged",
+			template:       template(1, "ubuntu:22.04"),
+			snapshot:       snapshot(1, "ubuntu:22.04"),
+			wantResolved:   true,
+			wantReason:     templateReasonResolved,
+			wantImage:      "ubuntu:22.04",
+			wantGeneration: 1,
+		},
+		{
+			name:           "template changed",
+			template:       template(2, "ubuntu:24.04"),
+			snapshot:       snapshot(1, "ubuntu:22.04"),
+			wantResolved:   true,
+			wantReason:     templateReasonOutOfDate,
+			wantImage:      "ubuntu:22.04",
+			wantGeneration: 1,
+		},
+		{
+			name:           "template changed with rollout",
+			template:       template(2, "ubuntu:24.04"),
+			snapshot:       snapshot(1, "ubuntu:22.04"),
+			policy:         inspectv1alpha1.TemplateUpdateRollout,
+			wantResolved:   true,
+			wantReason:     templateReasonRolledOut,
+			wantImage:      "ubuntu:24.04",
+			wantGeneration: 2,
+		},
+		{
+			name:           "template deleted",
+			snapshot:       snapshot(1, "ubuntu:22.04"),
+			wantResolved:   true,
+			wantReason:     templateReasonDeleted,
+			wantImage:      "ubuntu:22.04",
+			wantGeneration: 1,
+		},
+		{
+			name:       "merged spec invalid",
+			template:   template(1, ""),
+			wantReason: templateReasonInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newDNSSandbox(nil)
+			sandbox.Spec.TemplateRef = &inspectv1alpha1.TemplateReference{Name: "base", UpdatePolicy: tt.policy}
+			sandbox.Status.Template = tt.snapshot
+			objs := []client.Object{sandbox}
+			if tt.template != nil {
+				objs = append(objs, tt.template)
+			}
+			r := &InspectSandboxReconciler{Client: newFakeClient(objs...), Scheme: testScheme, Recorder: record.NewFakeRecorder(100)}
+
+			resolved, err := r.resolveTemplate(context.Background(), sandbox)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if resolved != tt.wantResolved {
+				t.Errorf("resolved = %v, want %v", resolved, tt.wantResolved)
+			}
+			condition := meta.FindStatusCondition(sandbox.Status.Conditions, inspectv1alpha1.ConditionTemplateResolved)
+			if condition == nil || condition.Reason != tt.wantReason {
+				t.Fatalf("TemplateResolved = %+v, want reason %s", condition, tt.wantReason)
+			}
+			if !resolved {
+				return
+			}
+			if got := sandbox.Spec.Services["default"].Image; got != tt.wantImage {
+				t.Errorf("image = %q, want %q", got, tt.wantImage)
+			}
+			if sandbox.Spec.TemplateRef != nil {
+				t.Error("resolved spec still refers to the template")
+			}
+			if got := sandbox.Status.Template; got == nil || got.Generation != tt.wantGeneration {
+				t.Errorf("snapshot = %+v, want generation %d", got, tt.wantGeneration)
+			}
+		})
+	}
+}
+
+func TestMergeSandboxSpecSuspend(t *testing.T) {
+	for _, tt := range []struct {
+		base, overrides, want bool
+	}{
+		{base: false, overrides: false, want: false},
+		{base: false, overrides: true, want: true},
+		{base: true, overrides: false, want: false},
+		{base: true, overrides: true, want: true},
+	} {
+		base := inspectv1alpha1.InspectSandboxSpec{Suspend: tt.base}
+		overrides := inspectv1alpha1.InspectSandboxSpec{Suspend: tt.overrides}
+		if got := mergeSandboxSpec(&base, &overrides).Suspend; got != tt.want {
+			t.Errorf("template suspend %v, sandbox suspend %v: merged suspend = %v, want %v",
+				tt.base, tt.overrides, got, tt.want)
+		}
+	}
+}
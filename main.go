@@ -3,10 +3,12 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -16,6 +18,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	ciliumv2 "github.com/example/inspect-operator/api/cilium/v2"
 	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
 	"github.com/example/inspect-operator/controllers"
 )
@@ -28,16 +31,40 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(inspectv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(ciliumv2.AddToScheme(scheme))
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterDomain string
+	var clusterDNS string
+	var failureGracePeriod time.Duration
+	var enableWebhooks bool
+	var defaultRuntimeClass string
+	var defaultCPU string
+	var defaultMemory string
+	var networkPolicyBackend string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&clusterDomain, "cluster-domain", "cluster.local", "The DNS domain of the cluster.")
+	flag.StringVar(&clusterDNS, "cluster-dns", "",
+		"The address sandbox DNS resolvers forward queries to. Defaults to the kube-system/kube-dns Service IP.")
+	flag.DurationVar(&failureGracePeriod, "failure-grace-period", 2*time.Minute,
+		"How long a sandbox service may fail, e.g. with ImagePullBackOff, before the sandbox is marked Failed.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the InspectSandbox defaulting and validating webhooks. Requires serving certificates.")
+	flag.StringVar(&defaultRuntimeClass, "default-runtime-class", "",
+		"Runtime class given to services that don't set one, by the webhook or after merging a template.")
+	flag.StringVar(&defaultCPU, "default-cpu", "",
+		"CPU request and limit given to services that don't set resources.")
+	flag.StringVar(&defaultMemory, "default-memory", "",
+		"Memory request and limit given to services that don't set resources.")
+	flag.StringVar(&networkPolicyBackend, "network-policy-backend", "auto",
+		"How sandboxes are isolated: cilium, kubernetes, or auto to use Cilium when its CRDs are installed.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -63,14 +90,88 @@ func main() {
 		os.Exit(1)
 	}
 
+	backend := controllers.NetworkPolicyBackend(networkPolicyBackend)
+	switch backend {
+	case controllers.NetworkPolicyBackendCilium, controllers.NetworkPolicyBackendKubernetes:
+	case "auto":
+		backend, err = controllers.DetectNetworkPolicyBackend(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to detect network policy backend")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(nil, "invalid --network-policy-backend, expected auto, cilium or kubernetes",
+			"value", networkPolicyBackend)
+		os.Exit(1)
+	}
+	if backend == controllers.NetworkPolicyBackendKubernetes {
+		setupLog.Info("Cilium not in use, falling back to Kubernetes NetworkPolicies; allowDomains will not be enforced")
+	}
+
+	// The webhook defaults inline sandboxes, and the controller defaults
+	// sandboxes built from a template once it is merged in
+	defaulter := &inspectv1alpha1.InspectSandboxDefaulter{
+		RuntimeClassName: defaultRuntimeClass,
+	}
+	if err := defaulter.SetDefaultResource(corev1.ResourceCPU, defaultCPU); err != nil {
+		setupLog.Error(err, "invalid --default-cpu")
+		os.Exit(1)
+	}
+	if err := defaulter.SetDefaultResource(corev1.ResourceMemory, defaultMemory); err != nil {
+		setupLog.Error(err, "invalid --default-memory")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.InspectSandboxReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		ClusterDomain:        clusterDomain,
+		ClusterDNS:           clusterDNS,
+		APIReader:            mgr.GetAPIReader(),
+		FailureGracePeriod:   failureGracePeriod,
+		NetworkPolicyBackend: backend,
+		Defaulter:            defaulter,
+		Recorder:             mgr.GetEventRecorderFor("inspect-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "InspectSandbox")
 		os.Exit(1)
 	}
 
+	if err = (&controllers.InspectSandboxPoolReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("inspect-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "InspectSandboxPool")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.InspectSandboxClaimReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor("inspect-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "InspectSandboxClaim")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.InspectSandboxSetReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("inspect-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "InspectSandboxSet")
+		os.Exit(1)
+	}
+
+	if enableWebhooks {
+		if err := inspectv1alpha1.SetupWebhookWithManager(mgr, defaulter); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "InspectSandbox")
+			os.Exit(1)
+		}
+	}
+
 	// Add health check endpoints
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -0,0 +1,443 @@
+// Package compose converts Docker Compose files, as used to describe Inspect
+// task sandboxes, into InspectSandbox specs
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// DefaultService is the service Inspect runs commands in. A compose service
+// marked with x-default is renamed to it.
+const DefaultService = "default"
+
+// defaultNetwork is the network compose puts services on when they don't
+// list any
+const defaultNetwork = "default"
+
+// Convert parses a compose file and returns the equivalent sandbox spec,
+// along with a warning for everything in the file that couldn't be carried
+// over. The warnings name the offending key, e.g. services.web.ports.
+func Convert(data []byte) (*inspectv1alpha1.InspectSandboxSpec, []string, error) {
+	// Compose files are YAML 1.2, where keys such as N and on are strings
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("parsing compose file: %w", err)
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing compose file: %w", err)
+	}
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &file); err != nil {
+		return nil, nil, fmt.Errorf("parsing compose file: %w", err)
+	}
+
+	c := &converter{spec: &inspectv1alpha1.InspectSandboxSpec{}}
+	for _, key := range sortedKeys(file) {
+		raw := file[key]
+		var err error
+		switch key {
+		case "services":
+			// Converted last, once networks and volumes are known
+		case "networks":
+			err = c.convertNetworks(raw)
+		case "volumes":
+			err = c.convertVolumes(raw)
+		case "x-inspect_k8s_sandbox":
+			err = c.convertExtension(raw)
+		case "version", "name":
+			// Informational only
+		default:
+			if !strings.HasPrefix(key, "x-") {
+				c.warnf("%s is not supported and was ignored", key)
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if err := c.convertServices(file["services"]); err != nil {
+		return nil, nil, err
+	}
+	return c.spec, c.warnings, nil
+}
+
+// converter accumulates a spec and warnings while a compose file is read
+type converter struct {
+	spec     *inspectv1alpha1.InspectSandboxSpec
+	warnings []string
+}
+
+// warnf records a warning
+func (c *converter) warnf(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// convertNetworks declares the top-level networks. Their driver settings
+// have no equivalent, as sandbox networks only control which services can
+// reach each other.
+func (c *converter) convertNetworks(raw json.RawMessage) error {
+	var networks map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &networks); err != nil {
+		return err
+	}
+	for name := range networks {
+		c.declareNetwork(name)
+	}
+	return nil
+}
+
+// convertVolumes declares the top-level volumes with the operator's default
+// size and storage class
+func (c *converter) convertVolumes(raw json.RawMessage) error {
+	var volumes map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &volumes); err != nil {
+		return err
+	}
+	for name := range volumes {
+		c.declareVolume(name)
+	}
+	return nil
+}
+
+// convertExtension reads the x-inspect_k8s_sandbox extension
+func (c *converter) convertExtension(raw json.RawMessage) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(keys) {
+		if key != "allow_domains" {
+			c.warnf("x-inspect_k8s_sandbox.%s is not supported and was ignored", key)
+		}
+	}
+
+	var ext extension
+	if err := json.Unmarshal(raw, &ext); err != nil {
+		return err
+	}
+	c.spec.AllowDomains = ext.AllowDomains
+	return nil
+}
+
+// convertServices converts every service, renaming the one marked
+// x-default to the default service
+func (c *converter) convertServices(raw json.RawMessage) error {
+	var services map[string]json.RawMessage
+	if raw != nil {
+		if err := json.Unmarshal(raw, &services); err != nil {
+			return fmt.Errorf("services: %w", err)
+		}
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("compose file has no services")
+	}
+
+	c.spec.Services = make(map[string]inspectv1alpha1.ServiceSpec, len(services))
+	defaultName := ""
+	for _, name := range sortedKeys(services) {
+		svc, svcSpec, err := c.convertService(name, services[name])
+		if err != nil {
+			return fmt.Errorf("services.%s: %w", name, err)
+		}
+		c.spec.Services[name] = svcSpec
+		if svc.Default {
+			if defaultName != "" {
+				c.warnf("services.%s.x-default: %s is already the default service", name, defaultName)
+				continue
+			}
+			defaultName = name
+		}
+	}
+
+	switch {
+	case defaultName == "" || defaultName == DefaultService:
+		if !hasService(c.spec, DefaultService) {
+			c.warnf("services: no service is called %s or marked x-default, so Inspect won't know which to use",
+				DefaultService)
+		}
+	case hasService(c.spec, DefaultService):
+		c.warnf("services.%s.x-default: a service is already called %s, so it was not renamed",
+			defaultName, DefaultService)
+	default:
+		// Other services can still reach it by its compose name
+		svcSpec := c.spec.Services[defaultName]
+		svcSpec.AdditionalDNSRecords = append([]string{defaultName}, svcSpec.AdditionalDNSRecords...)
+		delete(c.spec.Services, defaultName)
+		c.spec.Services[DefaultService] = svcSpec
+		for _, other := range c.spec.Services {
+			for i := range other.DependsOn {
+				if other.DependsOn[i].Service == defaultName {
+					other.DependsOn[i].Service = DefaultService
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// convertService converts a single compose service
+func (c *converter) convertService(name string, raw json.RawMessage) (service, inspectv1alpha1.ServiceSpec, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return service{}, inspectv1alpha1.ServiceSpec{}, err
+	}
+	for _, key := range sortedKeys(keys) {
+		if !serviceKeys[key] && !strings.HasPrefix(key, "x-") {
+			c.warnf("services.%s.%s is not supported and was ignored", name, key)
+		}
+	}
+
+	var svc service
+	if err := json.Unmarshal(raw, &svc); err != nil {
+		return service{}, inspectv1alpha1.ServiceSpec{}, err
+	}
+
+	dnsRecord := true
+	svcSpec := inspectv1alpha1.ServiceSpec{
+		Image: svc.Image,
+		// Compose's entrypoint and command are Kubernetes' command and args
+		Command:    svc.Entrypoint,
+		Args:       svc.Command,
+		WorkingDir: svc.WorkingDir,
+		Env:        svc.Environment.Vars,
+		DNSRecord:  &dnsRecord,
+	}
+	if svc.Image == "" {
+		c.warnf("services.%s.image is required, building images is not supported", name)
+	}
+	if svc.Hostname != "" && svc.Hostname != name {
+		svcSpec.AdditionalDNSRecords = append(svcSpec.AdditionalDNSRecords, svc.Hostname)
+	}
+	if svc.Healthcheck != nil {
+		hc, err := c.convertHealthcheck(fmt.Sprintf("services.%s.healthcheck", name), *svc.Healthcheck)
+		if err != nil {
+			return service{}, inspectv1alpha1.ServiceSpec{}, fmt.Errorf("healthcheck: %w", err)
+		}
+		svcSpec.Healthcheck = hc
+	}
+
+	for _, dependency := range sortedKeys(svc.DependsOn) {
+		dep := inspectv1alpha1.ServiceDependency{Service: dependency}
+		switch condition := svc.DependsOn[dependency]; condition {
+		case "service_started":
+		case "service_healthy":
+			dep.Condition = inspectv1alpha1.DependencyHealthy
+		case "service_completed_successfully":
+			c.warnf("services.%s.depends_on.%s: waiting for a service to complete is not supported, waiting for it to start instead",
+				name, dependency)
+		default:
+			return service{}, inspectv1alpha1.ServiceSpec{}, fmt.Errorf("depends_on.%s: unknown condition %q",
+				dependency, condition)
+		}
+		svcSpec.DependsOn = append(svcSpec.DependsOn, dep)
+	}
+
+	for _, envName := range svc.Environment.FromHost {
+		c.warnf("services.%s.environment.%s has no value and can't be taken from the host, so it was ignored",
+			name, envName)
+	}
+
+	for i, mount := range svc.Volumes {
+		entry, ok := c.convertVolumeMount(fmt.Sprintf("services.%s.volumes[%d]", name, i), mount)
+		if ok {
+			svcSpec.Volumes = append(svcSpec.Volumes, entry)
+		}
+	}
+
+	// Compose puts services that don't list networks on its default one
+	svcNetworks := svc.Networks
+	if len(svcNetworks) == 0 {
+		svcNetworks = networks{defaultNetwork: nil}
+	}
+	for _, network := range sortedKeys(svcNetworks) {
+		c.declareNetwork(network)
+		svcSpec.Networks = append(svcSpec.Networks, network)
+		svcSpec.AdditionalDNSRecords = append(svcSpec.AdditionalDNSRecords, svcNetworks[network]...)
+	}
+
+	resources, err := c.convertResources(svc)
+	if err != nil {
+		return service{}, inspectv1alpha1.ServiceSpec{}, err
+	}
+	svcSpec.Resources = resources
+
+	return svc, svcSpec, nil
+}
+
+// convertVolumeMount converts a service volume to name:/path[:ro], or
+// returns false if it isn't a named volume
+func (c *converter) convertVolumeMount(path string, mount volumeMount) (string, bool) {
+	if mount.Type != "volume" {
+		c.warnf("%s: %s mounts are not supported, only named volumes", path, mount.Type)
+		return "", false
+	}
+	if mount.Source == "" {
+		c.warnf("%s: anonymous volumes are not supported, give the volume a name", path)
+		return "", false
+	}
+	if _, ok := c.spec.Volumes[mount.Source]; !ok {
+		c.warnf("%s: volume %s is not declared under volumes, declaring it", path, mount.Source)
+		c.declareVolume(mount.Source)
+	}
+
+	entry := fmt.Sprintf("%s:%s", mount.Source, mount.Target)
+	if mount.ReadOnly {
+		entry += ":ro"
+	}
+	return entry, true
+}
+
+// convertHealthcheck converts a healthcheck, or returns nil if it is
+// disabled or only refers to the image's own healthcheck
+func (c *converter) convertHealthcheck(path string, hc healthcheck) (*inspectv1alpha1.Healthcheck, error) {
+	if hc.Disable || (len(hc.Test) > 0 && hc.Test[0] == "NONE") {
+		return nil, nil
+	}
+	if len(hc.Test) == 0 {
+		c.warnf("%s.test is required, healthchecks from the image are not supported", path)
+		return nil, nil
+	}
+	if hc.StartInterval != "" {
+		c.warnf("%s.start_interval is not supported and was ignored", path)
+	}
+
+	converted := &inspectv1alpha1.Healthcheck{Retries: hc.Retries}
+	switch hc.Test[0] {
+	case "CMD":
+		converted.Exec = hc.Test[1:]
+	case "CMD-SHELL":
+		converted.Exec = []string{"/bin/sh", "-c", strings.Join(hc.Test[1:], " ")}
+	default:
+		return nil, fmt.Errorf("test must start with NONE, CMD or CMD-SHELL, not %q", hc.Test[0])
+	}
+
+	var err error
+	if converted.IntervalSeconds, err = parseSeconds(hc.Interval, 1); err != nil {
+		return nil, fmt.Errorf("interval: %w", err)
+	}
+	if converted.TimeoutSeconds, err = parseSeconds(hc.Timeout, 1); err != nil {
+		return nil, fmt.Errorf("timeout: %w", err)
+	}
+	if converted.StartPeriodSeconds, err = parseSeconds(hc.StartPeriod, 0); err != nil {
+		return nil, fmt.Errorf("start_period: %w", err)
+	}
+	return converted, nil
+}
+
+// convertResources turns mem_limit and cpus into resource limits
+func (c *converter) convertResources(svc service) (corev1.ResourceRequirements, error) {
+	var resources corev1.ResourceRequirements
+
+	if svc.MemLimit != "" {
+		bytes, err := parseMemory(string(svc.MemLimit))
+		if err != nil {
+			return resources, fmt.Errorf("mem_limit: %w", err)
+		}
+		resources.Limits = corev1.ResourceList{
+			corev1.ResourceMemory: *resource.NewQuantity(bytes, resource.BinarySI),
+		}
+	}
+
+	if svc.CPUs != "" {
+		cpus, err := resource.ParseQuantity(string(svc.CPUs))
+		if err != nil {
+			return resources, fmt.Errorf("cpus: %w", err)
+		}
+		if resources.Limits == nil {
+			resources.Limits = corev1.ResourceList{}
+		}
+		resources.Limits[corev1.ResourceCPU] = cpus
+	}
+
+	return resources, nil
+}
+
+// declareNetwork adds a network to the spec if it isn't there already
+func (c *converter) declareNetwork(name string) {
+	if c.spec.Networks == nil {
+		c.spec.Networks = map[string]string{}
+	}
+	if _, ok := c.spec.Networks[name]; !ok {
+		c.spec.Networks[name] = fmt.Sprintf("compose network %s", name)
+	}
+}
+
+// declareVolume adds a volume to the spec if it isn't there already
+func (c *converter) declareVolume(name string) {
+	if c.spec.Volumes == nil {
+		c.spec.Volumes = map[string]inspectv1alpha1.VolumeSpec{}
+	}
+	if _, ok := c.spec.Volumes[name]; !ok {
+		c.spec.Volumes[name] = inspectv1alpha1.VolumeSpec{}
+	}
+}
+
+// parseMemory parses a Docker memory size such as 512m or 2g into bytes.
+// Docker's units are binary, so 1k is 1024 bytes.
+func parseMemory(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "b")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q", s)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// parseSeconds parses a compose duration such as 1m30s into whole seconds,
+// rounding up to at least minimum, or returns nil if s is empty
+func parseSeconds(s string, minimum int32) (*int32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	seconds := max(int32((duration+time.Second-1)/time.Second), minimum)
+	return &seconds, nil
+}
+
+// hasService reports whether spec has a service called name
+func hasService(spec *inspectv1alpha1.InspectSandboxSpec, name string) bool {
+	_, ok := spec.Services[name]
+	return ok
+}
+
+// sortedKeys returns the keys of m in order, so output and warnings are
+// stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,695 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	inspectv1alpha1 "github.com/example/inspect-operator/api/v1alpha1"
+)
+
+// convertService converts a compose file with a single service called
+// default, given as the YAML under services.default
+func convertService(t *testing.T, service string) (inspectv1alpha1.ServiceSpec, []string) {
+	t.Helper()
+	spec, warnings, err := Convert([]byte("services:\n  default:\n" + indent(service, "    ")))
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	return spec.Services[DefaultService], warnings
+}
+
+// indent prefixes every line of s
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr string
+	}{
+		{in: "sleep infinity", want: []string{"sleep", "infinity"}},
+		{in: "  tail\t-f   /dev/null ", want: []string{"tail", "-f", "/dev/null"}},
+		{in: `sh -c "echo hello world"`, want: []string{"sh", "-c", "echo hello world"}},
+		{in: `echo 'it"s' "it's"`, want: []string{"echo", `it"s`, "it's"}},
+		{in: `echo a\ b c`, want: []string{"echo", "a b", "c"}},
+		{in: `echo 'a\b'`, want: []string{"echo", `a\b`}},
+		{in: `echo "" x`, want: []string{"echo", "", "x"}},
+		{in: "", want: nil},
+		{in: `echo "unterminated`, wantErr: `unterminated " quote`},
+		{in: `echo 'unterminated`, wantErr: `unterminated ' quote`},
+		{in: `echo trailing\`, wantErr: "trailing backslash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := splitWords(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitWords(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		service     string
+		wantCommand []string
+		wantArgs    []string
+		wantErr     string
+	}{
+		{
+			name:     "command string",
+			service:  "image: ubuntu\ncommand: sleep infinity",
+			wantArgs: []string{"sleep", "infinity"},
+		},
+		{
+			name:     "command list with numbers",
+			service:  "image: ubuntu\ncommand: [sleep, 2]",
+			wantArgs: []string{"sleep", "2"},
+		},
+		{
+			name:        "entrypoint string with quotes",
+			service:     `image: ubuntu` + "\n" + `entrypoint: sh -c "echo 'hi there'"`,
+			wantCommand: []string{"sh", "-c", "echo 'hi there'"},
+		},
+		{
+			name:        "entrypoint list and command",
+			service:     "image: ubuntu\nentrypoint: [/bin/bash, -c]\ncommand: [\"tail -f /dev/null\"]",
+			wantCommand: []string{"/bin/bash", "-c"},
+			wantArgs:    []string{"tail -f /dev/null"},
+		},
+		{
+			name:     "escaped space",
+			service:  `image: ubuntu` + "\n" + `command: 'ls my\ dir'`,
+			wantArgs: []string{"ls", "my dir"},
+		},
+		{
+			name:    "unterminated quote",
+			service: `image: ubuntu` + "\n" + `command: 'echo "oops'`,
+			wantErr: "unterminated",
+		},
+		{
+			name:    "not a string or list",
+			service: "image: ubuntu\ncommand: {a: b}",
+			wantErr: "expected a string or a list of strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Convert([]byte("services:\n  default:\n" + indent(tt.service, "    ")))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			svc, _ := convertService(t, tt.service)
+			if !reflect.DeepEqual(svc.Command, tt.wantCommand) {
+				t.Errorf("command = %q, want %q", svc.Command, tt.wantCommand)
+			}
+			if !reflect.DeepEqual(svc.Args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", svc.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestConvertEnvironment(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      string
+		want         []corev1.EnvVar
+		wantWarnings []string
+	}{
+		{
+			name:    "map, sorted by name",
+			service: "image: ubuntu\nenvironment:\n  B: two\n  A: 1\n  C: true",
+			want: []corev1.EnvVar{
+				{Name: "A", Value: "1"},
+				{Name: "B", Value: "two"},
+				{Name: "C", Value: "true"},
+			},
+		},
+		{
+			name:    "map numbers and booleans as written",
+			service: "image: ubuntu\nenvironment:\n  BIG: 10000000\n  RATE: 0.25\n  DEBUG: false\n  QUOTED: \"007\"",
+			want: []corev1.EnvVar{
+				{Name: "BIG", Value: "10000000"},
+				{Name: "DEBUG", Value: "false"},
+				{Name: "QUOTED", Value: "007"},
+				{Name: "RATE", Value: "0.25"},
+			},
+		},
+		{
+			name:    "list, in order",
+			service: "image: ubuntu\nenvironment:\n  - B=two\n  - A=x=y\n  - EMPTY=",
+			want: []corev1.EnvVar{
+				{Name: "B", Value: "two"},
+				{Name: "A", Value: "x=y"},
+				{Name: "EMPTY", Value: ""},
+			},
+		},
+		{
+			name:    "map entries taken from the host",
+			service: "image: ubuntu\nenvironment:\n  TOKEN:\n  A: a",
+			want:    []corev1.EnvVar{{Name: "A", Value: "a"}},
+			wantWarnings: []string{
+				"services.default.environment.TOKEN has no value and can't be taken from the host, so it was ignored",
+			},
+		},
+		{
+			name:    "list entries taken from the host",
+			service: "image: ubuntu\nenvironment: [TOKEN, A=a]",
+			want:    []corev1.EnvVar{{Name: "A", Value: "a"}},
+			wantWarnings: []string{
+				"services.default.environment.TOKEN has no value and can't be taken from the host, so it was ignored",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, warnings := convertService(t, tt.service)
+			if !reflect.DeepEqual(svc.Env, tt.want) {
+				t.Errorf("env = %+v, want %+v", svc.Env, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertVolumes(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		wantMounts   []string
+		wantVolumes  []string
+		wantWarnings []string
+	}{
+		{
+			name: "short syntax",
+			file: `
+services:
+  default:
+    image: ubuntu
+    volumes:
+      - data:/data
+      - cache:/cache:ro
+      - logs:/logs:rw,z
+volumes:
+  data:
+  cache:
+  logs:
+`,
+			wantMounts:  []string{"data:/data", "cache:/cache:ro", "logs:/logs"},
+			wantVolumes: []string{"cache", "data", "logs"},
+		},
+		{
+			name: "long syntax",
+			file: `
+services:
+  default:
+    image: ubuntu
+    volumes:
+      - type: volume
+        source: data
+        target: /data
+        read_only: true
+volumes:
+  data: {}
+`,
+			wantMounts:  []string{"data:/data:ro"},
+			wantVolumes: []string{"data"},
+		},
+		{
+			name: "bind and anonymous mounts",
+			file: `
+services:
+  default:
+    image: ubuntu
+    volumes:
+      - ./src:/src
+      - /etc/hosts:/etc/hosts:ro
+      - ~/cache:/cache
+      - /scratch
+      - type: bind
+        source: .
+        target: /app
+`,
+			wantWarnings: []string{
+				"services.default.volumes[0]: bind mounts are not supported, only named volumes",
+				"services.default.volumes[1]: bind mounts are not supported, only named volumes",
+				"services.default.volumes[2]: bind mounts are not supported, only named volumes",
+				"services.default.volumes[3]: anonymous volumes are not supported, give the volume a name",
+				"services.default.volumes[4]: bind mounts are not supported, only named volumes",
+			},
+		},
+		{
+			name: "undeclared volume",
+			file: `
+services:
+  default:
+    image: ubuntu
+    volumes: [data:/data]
+`,
+			wantMounts:   []string{"data:/data"},
+			wantVolumes:  []string{"data"},
+			wantWarnings: []string{"services.default.volumes[0]: volume data is not declared under volumes, declaring it"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, warnings, err := Convert([]byte(tt.file))
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if got := spec.Services[DefaultService].Volumes; !reflect.DeepEqual(got, tt.wantMounts) {
+				t.Errorf("mounts = %q, want %q", got, tt.wantMounts)
+			}
+			if got := sortedKeys(spec.Volumes); len(got) > 0 || len(tt.wantVolumes) > 0 {
+				if !reflect.DeepEqual(got, tt.wantVolumes) {
+					t.Errorf("volumes = %q, want %q", got, tt.wantVolumes)
+				}
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertNetworks(t *testing.T) {
+	spec, warnings, err := Convert([]byte(`
+services:
+  default:
+    image: ubuntu
+    hostname: box
+    networks:
+      frontend:
+        aliases: [app, app.internal]
+      backend:
+  db:
+    image: postgres
+    networks: [backend]
+  cache:
+    image: redis
+networks:
+  frontend:
+    driver: bridge
+  backend:
+`))
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+
+	wantNetworks := []string{"backend", "default", "frontend"}
+	if got := sortedKeys(spec.Networks); !reflect.DeepEqual(got, wantNetworks) {
+		t.Errorf("networks = %q, want %q", got, wantNetworks)
+	}
+
+	tests := []struct {
+		service      string
+		wantNetworks []string
+		wantRecords  []string
+	}{
+		{service: "default", wantNetworks: []string{"backend", "frontend"}, wantRecords: []string{"box", "app", "app.internal"}},
+		{service: "db", wantNetworks: []string{"backend"}},
+		{service: "cache", wantNetworks: []string{"default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			svc := spec.Services[tt.service]
+			if !reflect.DeepEqual(svc.Networks, tt.wantNetworks) {
+				t.Errorf("networks = %q, want %q", svc.Networks, tt.wantNetworks)
+			}
+			if !reflect.DeepEqual(svc.AdditionalDNSRecords, tt.wantRecords) {
+				t.Errorf("additionalDnsRecords = %q, want %q", svc.AdditionalDNSRecords, tt.wantRecords)
+			}
+			if svc.DNSRecord == nil || !*svc.DNSRecord {
+				t.Errorf("dnsRecord = %v, want true", svc.DNSRecord)
+			}
+		})
+	}
+}
+
+func TestConvertDependsOn(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		want         map[string][]inspectv1alpha1.ServiceDependency
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name: "list",
+			file: `
+services:
+  default: {image: ubuntu, depends_on: [db, cache]}
+  db: {image: postgres}
+  cache: {image: redis}
+`,
+			want: map[string][]inspectv1alpha1.ServiceDependency{
+				"default": {{Service: "cache"}, {Service: "db"}},
+			},
+		},
+		{
+			name: "conditions",
+			file: `
+services:
+  default:
+    image: ubuntu
+    depends_on:
+      db: {condition: service_healthy}
+      cache: {condition: service_started}
+      migrate: {condition: service_completed_successfully}
+  db: {image: postgres}
+  cache: {image: redis}
+  migrate: {image: app}
+`,
+			want: map[string][]inspectv1alpha1.ServiceDependency{
+				"default": {
+					{Service: "cache"},
+					{Service: "db", Condition: inspectv1alpha1.DependencyHealthy},
+					{Service: "migrate"},
+				},
+			},
+			wantWarnings: []string{
+				"services.default.depends_on.migrate: waiting for a service to complete is not supported, waiting for it to start instead",
+			},
+		},
+		{
+			name: "renamed default service",
+			file: `
+services:
+  agent: {image: ubuntu, x-default: true}
+  web: {image: nginx, depends_on: [agent]}
+`,
+			want: map[string][]inspectv1alpha1.ServiceDependency{
+				"web": {{Service: DefaultService}},
+			},
+		},
+		{
+			name: "unknown condition",
+			file: `
+services:
+  default: {image: ubuntu, depends_on: {db: {condition: service_ready}}}
+  db: {image: postgres}
+`,
+			wantErr: `unknown condition "service_ready"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, warnings, err := Convert([]byte(tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			for svcName, want := range tt.want {
+				if got := spec.Services[svcName].DependsOn; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s dependsOn = %+v, want %+v", svcName, got, want)
+				}
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertHealthcheck(t *testing.T) {
+	int32p := func(v int32) *int32 { return &v }
+
+	tests := []struct {
+		name         string
+		healthcheck  string
+		want         *inspectv1alpha1.Healthcheck
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:        "CMD with timings",
+			healthcheck: "test: [CMD, pg_isready, -U, postgres]\ninterval: 1m30s\ntimeout: 1500ms\nretries: 5\nstart_period: 40s",
+			want: &inspectv1alpha1.Healthcheck{
+				Exec:               []string{"pg_isready", "-U", "postgres"},
+				IntervalSeconds:    int32p(90),
+				TimeoutSeconds:     int32p(2),
+				Retries:            int32p(5),
+				StartPeriodSeconds: int32p(40),
+			},
+		},
+		{
+			name:        "CMD-SHELL",
+			healthcheck: "test: [CMD-SHELL, curl -f http://localhost || exit 1]",
+			want: &inspectv1alpha1.Healthcheck{
+				Exec: []string{"/bin/sh", "-c", "curl -f http://localhost || exit 1"},
+			},
+		},
+		{
+			name:        "string runs in a shell",
+			healthcheck: "test: curl -f http://localhost",
+			want: &inspectv1alpha1.Healthcheck{
+				Exec: []string{"/bin/sh", "-c", "curl -f http://localhost"},
+			},
+		},
+		{
+			name:        "sub-second interval rounds up",
+			healthcheck: "test: [CMD, pg_isready]\ninterval: 100ms",
+			want: &inspectv1alpha1.Healthcheck{
+				Exec:            []string{"pg_isready"},
+				IntervalSeconds: int32p(1),
+			},
+		},
+		{
+			name:        "start interval",
+			healthcheck: "test: [CMD, pg_isready]\nstart_interval: 1s",
+			want:        &inspectv1alpha1.Healthcheck{Exec: []string{"pg_isready"}},
+			wantWarnings: []string{
+				"services.default.healthcheck.start_interval is not supported and was ignored",
+			},
+		},
+		{
+			name:        "disabled",
+			healthcheck: "test: [CMD, pg_isready]\ndisable: true",
+		},
+		{
+			name:        "NONE",
+			healthcheck: "test: [NONE]",
+		},
+		{
+			name:        "inherited from the image",
+			healthcheck: "interval: 5s",
+			wantWarnings: []string{
+				"services.default.healthcheck.test is required, healthchecks from the image are not supported",
+			},
+		},
+		{
+			name:        "unknown test type",
+			healthcheck: "test: [EXEC, pg_isready]",
+			wantErr:     `test must start with NONE, CMD or CMD-SHELL, not "EXEC"`,
+		},
+		{
+			name:        "invalid duration",
+			healthcheck: "test: [CMD, pg_isready]\ninterval: soon",
+			wantErr:     "interval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := "image: postgres\nhealthcheck:\n" + indent(tt.healthcheck, "  ")
+			_, _, err := Convert([]byte("services:\n  default:\n" + indent(service, "    ")))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			svc, warnings := convertService(t, service)
+			if !reflect.DeepEqual(svc.Healthcheck, tt.want) {
+				t.Errorf("healthcheck = %+v, want %+v", svc.Healthcheck, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertWarnings(t *testing.T) {
+	_, warnings, err := Convert([]byte(`
+version: "3.8"
+name: task
+x-anchors: &anchor {image: ubuntu}
+configs:
+  app: {file: ./app.conf}
+services:
+  web:
+    image: nginx
+    ports: ["8080:80"]
+    restart: always
+    x-notes: ignored
+  db:
+    build: ./db
+x-inspect_k8s_sandbox:
+  allow_domains: [pypi.org]
+  runtime: gvisor
+`))
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+
+	want := []string{
+		"configs is not supported and was ignored",
+		"x-inspect_k8s_sandbox.runtime is not supported and was ignored",
+		"services.db.build is not supported and was ignored",
+		"services.db.image is required, building images is not supported",
+		"services.web.ports is not supported and was ignored",
+		"services.web.restart is not supported and was ignored",
+		"services: no service is called default or marked x-default, so Inspect won't know which to use",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings =\n%s\nwant\n%s", strings.Join(warnings, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConvertDefaultService(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		wantServices []string
+		wantRecords  []string
+		wantWarnings []string
+	}{
+		{
+			name: "renamed",
+			file: `
+services:
+  agent: {image: ubuntu, x-default: true}
+  web: {image: nginx}
+`,
+			wantServices: []string{"default", "web"},
+			wantRecords:  []string{"agent"},
+		},
+		{
+			name: "already called default",
+			file: `
+services:
+  default: {image: ubuntu}
+  agent: {image: ubuntu, x-default: true}
+`,
+			wantServices: []string{"agent", "default"},
+			wantWarnings: []string{"services.agent.x-default: a service is already called default, so it was not renamed"},
+		},
+		{
+			name: "marked twice",
+			file: `
+services:
+  a: {image: ubuntu, x-default: true}
+  b: {image: ubuntu, x-default: true}
+`,
+			wantServices: []string{"b", "default"},
+			wantRecords:  []string{"a"},
+			wantWarnings: []string{"services.b.x-default: a is already the default service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, warnings, err := Convert([]byte(tt.file))
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if got := sortedKeys(spec.Services); !reflect.DeepEqual(got, tt.wantServices) {
+				t.Errorf("services = %q, want %q", got, tt.wantServices)
+			}
+			if got := spec.Services[DefaultService].AdditionalDNSRecords; !reflect.DeepEqual(got, tt.wantRecords) {
+				t.Errorf("default additionalDnsRecords = %q, want %q", got, tt.wantRecords)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertResources(t *testing.T) {
+	svc, _ := convertService(t, "image: ubuntu\nmem_limit: 512m\ncpus: 0.5")
+	memory := svc.Resources.Limits[corev1.ResourceMemory]
+	if memory.Value() != 512<<20 {
+		t.Errorf("memory limit = %s, want 512Mi", memory.String())
+	}
+	cpu := svc.Resources.Limits[corev1.ResourceCPU]
+	if cpu.MilliValue() != 500 {
+		t.Errorf("cpu limit = %s, want 500m", cpu.String())
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "1k", want: 1 << 10},
+		{in: "1kb", want: 1 << 10},
+		{in: "512M", want: 512 << 20},
+		{in: "1.5g", want: 3 << 29},
+		{in: "", wantErr: true},
+		{in: "lots", wantErr: true},
+		{in: "-1g", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseMemory(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseMemory(%q) = %d, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseMemory(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
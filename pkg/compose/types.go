@@ -0,0 +1,339 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// service is the part of a compose service that can be carried over
+type service struct {
+	Image       string        `json:"image"`
+	Command     command       `json:"command"`
+	Entrypoint  command       `json:"entrypoint"`
+	WorkingDir  string        `json:"working_dir"`
+	Environment environment   `json:"environment"`
+	Volumes     []volumeMount `json:"volumes"`
+	Networks    networks      `json:"networks"`
+	Hostname    string        `json:"hostname"`
+	Default     bool          `json:"x-default"`
+	Healthcheck *healthcheck  `json:"healthcheck"`
+	DependsOn   dependsOn     `json:"depends_on"`
+	MemLimit    scalar        `json:"mem_limit"`
+	CPUs        scalar        `json:"cpus"`
+}
+
+// serviceKeys are the service keys the importer understands
+var serviceKeys = map[string]bool{
+	"image":       true,
+	"command":     true,
+	"entrypoint":  true,
+	"working_dir": true,
+	"environment": true,
+	"volumes":     true,
+	"networks":    true,
+	"hostname":    true,
+	"x-default":   true,
+	"healthcheck": true,
+	"depends_on":  true,
+	"mem_limit":   true,
+	"cpus":        true,
+}
+
+// extension is the x-inspect_k8s_sandbox top-level extension
+type extension struct {
+	AllowDomains []string `json:"allow_domains"`
+}
+
+// command is a compose command or entrypoint, given as a list or as a
+// string that is split like a shell would
+type command []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *command) UnmarshalJSON(data []byte) error {
+	var list []scalar
+	if err := json.Unmarshal(data, &list); err == nil {
+		*c = make(command, len(list))
+		for i, arg := range list {
+			(*c)[i] = string(arg)
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a string or a list of strings")
+	}
+	words, err := splitWords(s)
+	if err != nil {
+		return err
+	}
+	*c = words
+	return nil
+}
+
+// environment is a compose environment, given as a map or as a list of
+// NAME=value entries. Variables without a value are taken from the host
+// under compose, which a sandbox can't do, so they are kept apart.
+type environment struct {
+	Vars     []corev1.EnvVar
+	FromHost []string
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *environment) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, entry := range list {
+			name, value, ok := strings.Cut(entry, "=")
+			e.add(name, value, ok)
+		}
+		return nil
+	}
+
+	// Keep numbers and booleans as written rather than reformatting them,
+	// so 10000000 doesn't become 1e+07
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("expected a map or a list of NAME=value entries")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := strings.TrimSpace(string(values[name]))
+		var value string
+		switch {
+		case raw == "null":
+			e.add(name, "", false)
+			continue
+		case strings.HasPrefix(raw, `"`):
+			if err := json.Unmarshal(values[name], &value); err != nil {
+				return err
+			}
+		case strings.HasPrefix(raw, "{"), strings.HasPrefix(raw, "["):
+			return fmt.Errorf("%s: expected a string, number or boolean", name)
+		default:
+			value = raw
+		}
+		e.add(name, value, true)
+	}
+	return nil
+}
+
+// add records a variable, or that it is taken from the host if it has no
+// value
+func (e *environment) add(name, value string, hasValue bool) {
+	if !hasValue {
+		e.FromHost = append(e.FromHost, name)
+		return
+	}
+	e.Vars = append(e.Vars, corev1.EnvVar{Name: name, Value: value})
+}
+
+// volumeMount is a compose service volume, given in the short
+// source:target[:mode] form or the long form
+type volumeMount struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *volumeMount) UnmarshalJSON(data []byte) error {
+	var short string
+	if err := json.Unmarshal(data, &short); err != nil {
+		type long volumeMount
+		if err := json.Unmarshal(data, (*long)(v)); err != nil {
+			return fmt.Errorf("expected a string or a volume mapping")
+		}
+		return nil
+	}
+
+	parts := strings.Split(short, ":")
+	switch len(parts) {
+	case 1:
+		v.Target = parts[0]
+	case 2:
+		v.Source, v.Target = parts[0], parts[1]
+	default:
+		v.Source, v.Target = parts[0], parts[1]
+		for _, option := range strings.Split(parts[2], ",") {
+			v.ReadOnly = v.ReadOnly || option == "ro"
+		}
+	}
+	v.Type = "volume"
+	if strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "~") {
+		v.Type = "bind"
+	}
+	return nil
+}
+
+// networks are the networks a compose service joins, given as a list of
+// names or as a map from names to settings such as aliases
+type networks map[string][]string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (n *networks) UnmarshalJSON(data []byte) error {
+	*n = networks{}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, name := range list {
+			(*n)[name] = nil
+		}
+		return nil
+	}
+
+	var settings map[string]*struct {
+		Aliases []string `json:"aliases"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("expected a list of network names or a map of networks")
+	}
+	for name, network := range settings {
+		if network != nil {
+			(*n)[name] = network.Aliases
+		} else {
+			(*n)[name] = nil
+		}
+	}
+	return nil
+}
+
+// healthcheck is a compose service healthcheck
+type healthcheck struct {
+	Test          healthcheckTest `json:"test"`
+	Interval      string          `json:"interval"`
+	Timeout       string          `json:"timeout"`
+	Retries       *int32          `json:"retries"`
+	StartPeriod   string          `json:"start_period"`
+	StartInterval string          `json:"start_interval"`
+	Disable       bool            `json:"disable"`
+}
+
+// healthcheckTest is a healthcheck's test, given as a list starting with
+// NONE, CMD or CMD-SHELL, or as a string run by a shell
+type healthcheckTest []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *healthcheckTest) UnmarshalJSON(data []byte) error {
+	var list []scalar
+	if err := json.Unmarshal(data, &list); err == nil {
+		*t = make(healthcheckTest, len(list))
+		for i, arg := range list {
+			(*t)[i] = string(arg)
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a string or a list of strings")
+	}
+	*t = healthcheckTest{"CMD-SHELL", s}
+	return nil
+}
+
+// dependsOn are the services a compose service waits for, given as a list
+// of names or as a map from names to the condition to wait for
+type dependsOn map[string]string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *dependsOn) UnmarshalJSON(data []byte) error {
+	*d = dependsOn{}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, name := range list {
+			(*d)[name] = "service_started"
+		}
+		return nil
+	}
+
+	var settings map[string]*struct {
+		Condition string `json:"condition"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("expected a list of service names or a map of services")
+	}
+	for name, dependency := range settings {
+		(*d)[name] = "service_started"
+		if dependency != nil && dependency.Condition != "" {
+			(*d)[name] = dependency.Condition
+		}
+	}
+	return nil
+}
+
+// scalar is a compose value that may be written as a string or a number
+type scalar string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *scalar) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = scalar(str)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("expected a string or a number")
+	}
+	*s = scalar(number.String())
+	return nil
+}
+
+// splitWords splits s into words the way a shell would, honouring quotes
+// and backslash escapes
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}